@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// Grafana annotation fields
+	gAnnotationTimeField    = "time"
+	gAnnotationTimeEndField = "timeEnd"
+	gAnnotationTitleField   = "title"
+	gAnnotationTextField    = "text"
+	gAnnotationTagsField    = "tags"
+)
+
+// AnnotationOptions maps fields of log lines to annotations.
+// Empty field names are mapped to nothing, except the text,
+// which contains the message of the log line by default.
+type AnnotationOptions struct {
+	// TitleField is the field of the log line used as the title of the annotation
+	TitleField string `json:"titleField"`
+	// TextField is the field of the log line used as the text of the annotation
+	TextField string `json:"textField"`
+	// TagFields contains fields of the log line, e.g. stream labels, which values are used as tags
+	TagFields []string `json:"tagFields"`
+	// RegionKeyField is the field which pairs start and end events of the region.
+	// Log lines with the same value of the field are merged into a single region
+	// from the oldest to the newest line. Lines without the field are point annotations.
+	RegionKeyField string `json:"regionKeyField"`
+}
+
+// annotation represents a single annotation or region
+type annotation struct {
+	time    time.Time
+	timeEnd time.Time
+	title   string
+	text    string
+	tags    []string
+}
+
+// logLine gives access to fields of the log line in the log frame
+type logLine struct {
+	message string
+	labels  map[string]string
+}
+
+// field returns the value of the log line field
+func (l logLine) field(name string) string {
+	if name == messageField {
+		return l.message
+	}
+	return l.labels[name]
+}
+
+// annotationsFrame converts the log frame into the frame of annotations
+// with time, timeEnd, title, text and tags fields
+func (ao AnnotationOptions) annotationsFrame(frame *data.Frame) (*data.Frame, error) {
+	timeIdx := logsTimeFieldIdx(frame)
+	lineIdx, labelsIdx := -1, -1
+	for i, f := range frame.Fields {
+		switch f.Name {
+		case gLineField:
+			lineIdx = i
+		case gLabelsField:
+			labelsIdx = i
+		}
+	}
+	if timeIdx < 0 || lineIdx < 0 || labelsIdx < 0 {
+		return nil, fmt.Errorf("failed to prepare annotations: frame doesn't contain log line fields")
+	}
+
+	textField := ao.TextField
+	if textField == "" {
+		textField = messageField
+	}
+
+	var annotations []*annotation
+	regions := make(map[string]*annotation)
+	for i := 0; i < frame.Rows(); i++ {
+		ts, _ := frame.Fields[timeIdx].At(i).(time.Time)
+		line := logLine{}
+		line.message, _ = frame.Fields[lineIdx].At(i).(string)
+		if raw, ok := frame.Fields[labelsIdx].At(i).(json.RawMessage); ok && len(raw) > 0 {
+			if err := json.Unmarshal(raw, &line.labels); err != nil {
+				return nil, fmt.Errorf("failed to prepare annotations: cannot parse labels of line #%d: %w", i, err)
+			}
+		}
+
+		var key string
+		if ao.RegionKeyField != "" {
+			key = line.field(ao.RegionKeyField)
+		}
+		if a, ok := regions[key]; ok && key != "" {
+			if ts.Before(a.time) {
+				// the region is described by its oldest line
+				ao.describe(a, line, textField)
+				a.time = ts
+			}
+			if ts.After(a.timeEnd) {
+				a.timeEnd = ts
+			}
+			continue
+		}
+
+		a := &annotation{time: ts, timeEnd: ts}
+		ao.describe(a, line, textField)
+		annotations = append(annotations, a)
+		if key != "" {
+			regions[key] = a
+		}
+	}
+
+	timeFd := data.NewFieldFromFieldType(data.FieldTypeTime, len(annotations))
+	timeFd.Name = gAnnotationTimeField
+	timeEndFd := data.NewFieldFromFieldType(data.FieldTypeTime, len(annotations))
+	timeEndFd.Name = gAnnotationTimeEndField
+	titleFd := data.NewFieldFromFieldType(data.FieldTypeString, len(annotations))
+	titleFd.Name = gAnnotationTitleField
+	textFd := data.NewFieldFromFieldType(data.FieldTypeString, len(annotations))
+	textFd.Name = gAnnotationTextField
+	tagsFd := data.NewFieldFromFieldType(data.FieldTypeJSON, len(annotations))
+	tagsFd.Name = gAnnotationTagsField
+	for i, a := range annotations {
+		tags, err := json.Marshal(a.tags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare annotations: cannot marshal tags: %w", err)
+		}
+		timeFd.Set(i, a.time)
+		timeEndFd.Set(i, a.timeEnd)
+		titleFd.Set(i, a.title)
+		textFd.Set(i, a.text)
+		tagsFd.Set(i, json.RawMessage(tags))
+	}
+
+	return data.NewFrame("", timeFd, timeEndFd, titleFd, textFd, tagsFd), nil
+}
+
+// describe sets the title, the text and tags of the annotation from the log line
+func (ao AnnotationOptions) describe(a *annotation, line logLine, textField string) {
+	if ao.TitleField != "" {
+		a.title = line.field(ao.TitleField)
+	}
+	a.text = line.field(textField)
+	a.tags = make([]string, 0, len(ao.TagFields))
+	for _, name := range ao.TagFields {
+		if v := line.field(strings.TrimSpace(name)); v != "" {
+			a.tags = append(a.tags, v)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestAnnotationOptions_annotationsFrame(t *testing.T) {
+	type ann struct {
+		time    string
+		timeEnd string
+		title   string
+		text    string
+		tags    []string
+	}
+	f := func(ao AnnotationOptions, response string, want []ann) {
+		t.Helper()
+		rsp := parseInstantResponse(strings.NewReader(response), newLineCounters("test"), logsParseOptions{})
+		if rsp.Error != nil {
+			t.Fatalf("unexpected error: %s", rsp.Error)
+		}
+		frame, err := ao.annotationsFrame(rsp.Frames[0])
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if frame.Rows() != len(want) {
+			t.Fatalf("expected %d annotations; got %d", len(want), frame.Rows())
+		}
+		for i, w := range want {
+			got := ann{
+				time:    frame.Fields[0].At(i).(time.Time).Format(time.RFC3339),
+				timeEnd: frame.Fields[1].At(i).(time.Time).Format(time.RFC3339),
+				title:   frame.Fields[2].At(i).(string),
+				text:    frame.Fields[3].At(i).(string),
+			}
+			if err := json.Unmarshal(frame.Fields[4].At(i).(json.RawMessage), &got.tags); err != nil {
+				t.Fatalf("cannot parse tags: %s", err)
+			}
+			if !reflect.DeepEqual(got, w) {
+				t.Fatalf("unexpected annotation #%d\ngot:  %+v\nwant: %+v", i, got, w)
+			}
+		}
+	}
+
+	// text is the message by default
+	f(AnnotationOptions{}, `{"_time":"2024-01-01T00:00:00Z","_msg":"deployed","_stream":"{app=\"api\"}"}`,
+		[]ann{{time: "2024-01-01T00:00:00Z", timeEnd: "2024-01-01T00:00:00Z", text: "deployed", tags: []string{}}})
+
+	// title, text and tags from fields and stream labels
+	f(AnnotationOptions{TitleField: "_msg", TextField: "version", TagFields: []string{"app", "env", "missing"}},
+		`{"_time":"2024-01-01T00:00:00Z","_msg":"deployed","_stream":"{app=\"api\",env=\"prod\"}","version":"v1.2.3"}`,
+		[]ann{{time: "2024-01-01T00:00:00Z", timeEnd: "2024-01-01T00:00:00Z", title: "deployed", text: "v1.2.3", tags: []string{"api", "prod"}}})
+
+	// regions are paired by the key field and described by the oldest line
+	f(AnnotationOptions{TitleField: "_msg", TagFields: []string{"app"}, RegionKeyField: "deploy_id"},
+		`{"_time":"2024-01-01T00:10:00Z","_msg":"deploy finished","_stream":"{app=\"api\"}","deploy_id":"1"}
+{"_time":"2024-01-01T00:05:00Z","_msg":"restart","_stream":"{app=\"db\"}"}
+{"_time":"2024-01-01T00:00:00Z","_msg":"deploy started","_stream":"{app=\"api\"}","deploy_id":"1"}
+{"_time":"2024-01-01T00:02:00Z","_msg":"deploy started","_stream":"{app=\"web\"}","deploy_id":"2"}`,
+		[]ann{
+			{time: "2024-01-01T00:00:00Z", timeEnd: "2024-01-01T00:10:00Z", title: "deploy started", text: "deploy started", tags: []string{"api"}},
+			{time: "2024-01-01T00:05:00Z", timeEnd: "2024-01-01T00:05:00Z", title: "restart", text: "restart", tags: []string{"db"}},
+			{time: "2024-01-01T00:02:00Z", timeEnd: "2024-01-01T00:02:00Z", title: "deploy started", text: "deploy started", tags: []string{"web"}},
+		})
+}
+
+func TestAnnotationOptions_annotationsFrameError(t *testing.T) {
+	frame := data.NewFrame("", data.NewField(gTimeField, nil, []time.Time{}))
+	if _, err := (AnnotationOptions{}).annotationsFrame(frame); err == nil {
+		t.Fatalf("expected error for the frame without log line fields")
+	}
+}
+
+func TestDatasource_annotationsQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintln(w, `{"_time":"2024-01-01T00:00:00Z","_msg":"deploy started","deploy_id":"1"}`)
+		_, _ = fmt.Fprintln(w, `{"_time":"2024-01-01T00:01:00Z","_msg":"deploy finished","deploy_id":"1"}`)
+	}))
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{URL: srv.URL, JSONData: []byte(`{}`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	q := &Query{
+		DataQuery:  backend.DataQuery{RefID: "Anno", TimeRange: backend.TimeRange{From: time.Unix(0, 0), To: time.Now()}},
+		Expr:       "deploy",
+		QueryType:  QueryTypeInstant,
+		Format:     QueryFormatAnnotations,
+		Annotation: AnnotationOptions{TitleField: "_msg", RegionKeyField: "deploy_id"},
+	}
+	if err := q.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rsp := ds.query(context.Background(), q)
+	if rsp.Error != nil {
+		t.Fatalf("unexpected error: %s", rsp.Error)
+	}
+	frame := rsp.Frames[0]
+	if frame.Rows() != 1 || frame.Fields[0].Name != gAnnotationTimeField || frame.Fields[1].Name != gAnnotationTimeEndField {
+		t.Fatalf("expected a single region; got %d rows", frame.Rows())
+	}
+	start := frame.Fields[0].At(0).(time.Time)
+	end := frame.Fields[1].At(0).(time.Time)
+	if end.Sub(start) != time.Minute || frame.Fields[2].At(0) != "deploy started" {
+		t.Fatalf("unexpected region %s - %s %q", start, end, frame.Fields[2].At(0))
+	}
+}
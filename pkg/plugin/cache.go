@@ -0,0 +1,252 @@
+package plugin
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const defaultCacheTTL = time.Minute
+
+var (
+	cacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "result_cache_hits_total",
+		Help:      "The number of responses of stats and hits queries served from the result cache",
+	}, []string{"datasource_uid"})
+	cacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "result_cache_misses_total",
+		Help:      "The number of responses of stats and hits queries missed in the result cache",
+	}, []string{"datasource_uid"})
+)
+
+// lruCache is a LRU cache with optional expiration of the entries
+type lruCache struct {
+	mu      sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	items   map[string]*list.Element
+	ll      *list.List
+
+	hits   prometheus.Counter
+	misses prometheus.Counter
+}
+
+type cacheEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// newLRUCache returns a new lruCache which can hold up to maxSize entries
+// for the given ttl. Entries never expire if ttl is zero.
+func newLRUCache(maxSize int, ttl time.Duration, hits, misses prometheus.Counter) *lruCache {
+	return &lruCache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		items:   make(map[string]*list.Element),
+		ll:      list.New(),
+		hits:    hits,
+		misses:  misses,
+	}
+}
+
+// newResultCache returns a new lruCache for responses of stats and hits queries
+func newResultCache(datasourceUID string, maxSize int, ttl time.Duration) *lruCache {
+	return newLRUCache(maxSize, ttl, cacheHits.WithLabelValues(datasourceUID), cacheMisses.WithLabelValues(datasourceUID))
+}
+
+// get returns the cached value for the given key if it is not expired
+func (c *lruCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.misses.Inc()
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Now().After(e.expiresAt) {
+		c.removeElement(el)
+		c.misses.Inc()
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	c.hits.Inc()
+	return e.value, true
+}
+
+// set stores the value for the given key and evicts
+// the least recently used entries if cache is full
+func (c *lruCache) set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*cacheEntry)
+		e.value = value
+		e.expiresAt = expiresAt
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	el := c.ll.PushFront(&cacheEntry{key: key, value: value, expiresAt: expiresAt})
+	c.items[key] = el
+	for c.ll.Len() > c.maxSize {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).key)
+}
+
+// len returns the number of entries in the cache
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// reset removes all entries from the cache
+func (c *lruCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[string]*list.Element)
+	c.ll.Init()
+}
+
+// cacheKey returns the key for the request url, tenant headers, headers
+// forwarded from the Grafana request and the signed identity of the user.
+// The url must be normalized, which is guaranteed by url.Values.Encode.
+// Forwarded headers and the identity identify the user, so responses
+// are not shared between users with different access rights.
+func cacheKey(reqURL string, headers, forwardedHeaders http.Header, identity string) string {
+	var sb strings.Builder
+	sb.WriteString(reqURL)
+	for _, h := range tenantHeaders {
+		sb.WriteString("\n")
+		sb.WriteString(h)
+		sb.WriteString("=")
+		sb.WriteString(headers.Get(h))
+	}
+	if len(forwardedHeaders) > 0 {
+		sb.WriteString("\nforwarded=")
+		sb.WriteString(headersDigest(forwardedHeaders))
+	}
+	if identity != "" {
+		sb.WriteString("\nidentity=")
+		sb.WriteString(identity)
+	}
+	return sb.String()
+}
+
+// headersDigest returns the hash of the headers, so the values
+// of credentials are not kept in the cache keys
+func headersDigest(headers http.Header) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(http.CanonicalHeaderKey(name)))
+		for _, v := range headers[name] {
+			h.Write([]byte{0})
+			h.Write([]byte(v))
+		}
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isCacheable checks if the response of the query can be cached.
+// Alerting requests are always sent to the datasource.
+func (q *Query) isCacheable() bool {
+	if q.ForAlerting {
+		return false
+	}
+	switch q.QueryType {
+	case QueryTypeStats, QueryTypeStatsRange, QueryTypeHits:
+		return true
+	default:
+		return false
+	}
+}
+
+// cachedQuery returns the response of the query from the result cache
+// or sends the query to the datasource and caches the successful response
+func (d *Datasource) cachedQuery(ctx context.Context, q *Query) backend.DataResponse {
+	q.alignToStep = true
+	if q.QueryType == QueryTypeStats {
+		// stats query has no step, so its time range is aligned to the cache ttl.
+		// Otherwise, the key of the moving time range is changed every second.
+		q.TimeRange = truncateTimeRange(q.TimeRange, d.grafanaSettings.cacheTTL)
+	}
+	reqURL, err := q.getQueryURL(d.settings.URL, d.grafanaSettings.QueryParams)
+	if err != nil {
+		return newResponseError(fmt.Errorf("failed to create request URL: %w", err), backend.StatusInternal)
+	}
+
+	headers := d.queryHeaders(q)
+	key := cacheKey(reqURL, headers, q.forwardedHeaders, q.identity.cacheKey())
+	if v, ok := d.resultCache.get(key); ok {
+		return d.parseResponse(ctx, bytes.NewReader(v.([]byte)), q)
+	}
+
+	r, err := d.sendRequest(ctx, reqURL, headers, q.ForAlerting)
+	if err != nil {
+		return newRequestErrorResponse(err)
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			log.DefaultLogger.Error("failed to close response body", "err", err.Error())
+		}
+	}()
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return newRequestErrorResponse(fmt.Errorf("failed to read response body: %w", err))
+	}
+
+	rsp := d.parseResponse(ctx, bytes.NewReader(body), q)
+	if rsp.Error == nil {
+		d.resultCache.set(key, body)
+	}
+	return rsp
+}
+
+// truncateTimeRange truncates both ends of the time range down to the multiple of d.
+// Empty ends of the time range are kept as is.
+func truncateTimeRange(tr backend.TimeRange, d time.Duration) backend.TimeRange {
+	if d <= 0 {
+		return tr
+	}
+	if !tr.From.IsZero() {
+		tr.From = tr.From.Truncate(d)
+	}
+	if !tr.To.IsZero() {
+		tr.To = tr.To.Truncate(d)
+	}
+	return tr
+}
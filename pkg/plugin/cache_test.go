@@ -0,0 +1,205 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatalf("cannot read counter: %s", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestLRUCache(t *testing.T) {
+	c := newResultCache("test-lru", 2, time.Minute)
+
+	c.set("a", []byte("1"))
+	c.set("b", []byte("2"))
+	if _, ok := c.get("a"); !ok {
+		t.Fatalf("expected key a to be cached")
+	}
+	// b is the least recently used key, so it must be evicted
+	c.set("c", []byte("3"))
+	if _, ok := c.get("b"); ok {
+		t.Fatalf("expected key b to be evicted")
+	}
+	if v, ok := c.get("c"); !ok || string(v.([]byte)) != "3" {
+		t.Fatalf("expected key c to be cached; got %v", v)
+	}
+	c.set("c", []byte("4"))
+	if v, _ := c.get("c"); string(v.([]byte)) != "4" {
+		t.Fatalf("expected updated value for key c; got %v", v)
+	}
+	if c.len() != 2 {
+		t.Fatalf("expected 2 entries; got %d", c.len())
+	}
+	if got := counterValue(t, c.hits); got != 3 {
+		t.Fatalf("expected 3 hits; got %v", got)
+	}
+	if got := counterValue(t, c.misses); got != 1 {
+		t.Fatalf("expected 1 miss; got %v", got)
+	}
+
+	expired := newResultCache("test-ttl", 2, time.Nanosecond)
+	expired.set("a", []byte("1"))
+	time.Sleep(time.Millisecond)
+	if _, ok := expired.get("a"); ok {
+		t.Fatalf("expected key a to be expired")
+	}
+	if expired.len() != 0 {
+		t.Fatalf("expected expired entry to be removed")
+	}
+}
+
+func Test_cacheKey(t *testing.T) {
+	u := "http://localhost:9428/select/logsql/hits?query=*"
+	k1 := cacheKey(u, http.Header{"Accountid": {"1"}}, nil, "")
+	k2 := cacheKey(u, http.Header{"Accountid": {"2"}}, nil, "")
+	k3 := cacheKey(u, http.Header{"Accountid": {"1"}, "X-Custom": {"a"}}, nil, "")
+	if k1 == k2 {
+		t.Fatalf("expected different keys for different tenants")
+	}
+	if k1 != k3 {
+		t.Fatalf("expected non-tenant headers to be ignored")
+	}
+
+	// responses must not be shared between users
+	k4 := cacheKey(u, http.Header{"Accountid": {"1"}}, http.Header{"Authorization": {"Bearer user1"}}, "")
+	k5 := cacheKey(u, http.Header{"Accountid": {"1"}}, http.Header{"Authorization": {"Bearer user2"}}, "")
+	k6 := cacheKey(u, http.Header{"Accountid": {"1"}}, http.Header{"Authorization": {"Bearer user1"}}, "")
+	if k4 == k1 || k4 == k5 {
+		t.Fatalf("expected different keys for different forwarded headers")
+	}
+	if k4 != k6 {
+		t.Fatalf("expected the same keys for the same forwarded headers")
+	}
+	if strings.Contains(k4, "user1") {
+		t.Fatalf("forwarded header values must not be kept in the key; got %q", k4)
+	}
+
+	// responses must not be shared between users with different signed identities
+	k7 := cacheKey(u, http.Header{"Accountid": {"1"}}, nil, "alice")
+	k8 := cacheKey(u, http.Header{"Accountid": {"1"}}, nil, "bob")
+	if k7 == k1 || k7 == k8 {
+		t.Fatalf("expected different keys for different identities")
+	}
+}
+
+func TestDatasource_cachedQuery(t *testing.T) {
+	var requests atomic.Int32
+	var lastEnd atomic.Value
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/stats_query_range", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		lastEnd.Store(r.URL.Query().Get("end"))
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1704067200,"1"]]}]}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		UID:      "test-cached-query",
+		URL:      srv.URL,
+		JSONData: []byte(`{"resultCacheSize":10,"resultCacheTTL":"5m"}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+	defer ds.Dispose()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := func(offset time.Duration, forAlerting bool, wantRequests int32, wantEnd string) {
+		t.Helper()
+		q := &Query{
+			DataQuery: backend.DataQuery{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: from.Add(offset), To: from.Add(time.Hour - time.Minute + offset)},
+			},
+			Expr:        "* | stats count()",
+			Step:        "1h",
+			QueryType:   QueryTypeStatsRange,
+			ForAlerting: forAlerting,
+		}
+		rsp := ds.query(context.Background(), q)
+		if rsp.Error != nil {
+			t.Fatalf("unexpected error: %s", rsp.Error)
+		}
+		if len(rsp.Frames) != 1 {
+			t.Fatalf("expected 1 frame; got %d", len(rsp.Frames))
+		}
+		if requests.Load() != wantRequests {
+			t.Fatalf("expected %d requests; got %d", wantRequests, requests.Load())
+		}
+		if got := lastEnd.Load(); got != wantEnd {
+			t.Fatalf("expected end param %q; got %q", wantEnd, got)
+		}
+	}
+
+	// the end of the time range is aligned to the step
+	f(0, false, 1, "1704070800")
+	// the same step aligned time range must be served from the cache
+	f(30*time.Second, false, 1, "1704070800")
+	// alerting requests bypass the cache and are not aligned
+	f(0, true, 2, "1704070740")
+}
+
+func TestDatasource_cachedStatsQuery(t *testing.T) {
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/stats_query", func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1704067200,"1"]}]}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		UID:      "test-cached-stats-query",
+		URL:      srv.URL,
+		JSONData: []byte(`{"resultCacheSize":10,"resultCacheTTL":"1m"}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+	defer ds.Dispose()
+
+	to := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := func(offset time.Duration, wantRequests int32) {
+		t.Helper()
+		q := &Query{
+			DataQuery: backend.DataQuery{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: to.Add(-time.Hour + offset), To: to.Add(offset)},
+			},
+			Expr:      "* | stats count()",
+			QueryType: QueryTypeStats,
+		}
+		rsp := ds.query(context.Background(), q)
+		if rsp.Error != nil {
+			t.Fatalf("unexpected error: %s", rsp.Error)
+		}
+		if requests.Load() != wantRequests {
+			t.Fatalf("expected %d requests; got %d", wantRequests, requests.Load())
+		}
+	}
+
+	f(0, 1)
+	// the moving time range is aligned to the cache ttl
+	f(10*time.Second, 1)
+	f(70*time.Second, 2)
+}
@@ -0,0 +1,367 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	defaultCBFailureThreshold = 5
+	defaultCBFailureRate      = 0.5
+	defaultCBMinRequests      = 20
+	defaultCBWindow           = time.Minute
+	defaultCBOpenTimeout      = 30 * time.Second
+	defaultCBHalfOpenRequests = 1
+)
+
+var (
+	circuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "circuit_breaker_state",
+		Help:      "The state of the circuit breaker for the VictoriaLogs endpoint: 0 - closed, 1 - half-open, 2 - open",
+	}, []string{"datasource_uid", "endpoint"})
+	circuitBreakerRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "circuit_breaker_rejected_requests_total",
+		Help:      "The number of requests to the VictoriaLogs endpoint rejected by the open circuit breaker",
+	}, []string{"datasource_uid", "endpoint"})
+)
+
+var (
+	// errCircuitOpen is returned when the request is rejected by the circuit breaker
+	errCircuitOpen = errors.New("circuit breaker is open")
+	// errCallerInterrupted is registered by the circuit breaker when the request
+	// is interrupted by the caller, e.g. by Grafana query timeout
+	errCallerInterrupted = errors.New("request is interrupted by the caller")
+)
+
+// CircuitBreakerSettings contains the circuit breaker settings
+type CircuitBreakerSettings struct {
+	// Enabled enables the circuit breaker
+	Enabled bool `json:"enabled"`
+	// FailureThreshold defines the number of consecutive failed requests
+	// after which the circuit breaker opens
+	FailureThreshold int `json:"failureThreshold"`
+	// FailureRate defines the ratio of failed requests in the window
+	// after which the circuit breaker opens. The value must be in (0, 1] range.
+	FailureRate float64 `json:"failureRate"`
+	// MinRequests defines the min number of requests in the window
+	// required to check the failure rate
+	MinRequests int `json:"minRequests"`
+	// Window defines the interval during which the failure rate is calculated
+	Window string `json:"window"`
+	// OpenTimeout defines how long the circuit breaker stays open
+	// before it allows probe requests
+	OpenTimeout string `json:"openTimeout"`
+	// HalfOpenRequests defines the number of successful probe requests
+	// required to close the circuit breaker
+	HalfOpenRequests int `json:"halfOpenRequests"`
+}
+
+// circuitBreakerConfig contains the parsed circuit breaker settings
+type circuitBreakerConfig struct {
+	enabled          bool
+	failureThreshold int
+	failureRate      float64
+	minRequests      int
+	window           time.Duration
+	openTimeout      time.Duration
+	halfOpenRequests int
+}
+
+// parse returns the circuit breaker config based on settings.
+// Default values are used for empty settings.
+func (cs CircuitBreakerSettings) parse() (circuitBreakerConfig, error) {
+	cfg := circuitBreakerConfig{
+		enabled:          cs.Enabled,
+		failureThreshold: defaultCBFailureThreshold,
+		failureRate:      defaultCBFailureRate,
+		minRequests:      defaultCBMinRequests,
+		halfOpenRequests: defaultCBHalfOpenRequests,
+	}
+	if cs.FailureThreshold < 0 {
+		return cfg, fmt.Errorf("failure threshold can't be negative; got %d", cs.FailureThreshold)
+	}
+	if cs.FailureThreshold > 0 {
+		cfg.failureThreshold = cs.FailureThreshold
+	}
+	if cs.FailureRate < 0 || cs.FailureRate > 1 {
+		return cfg, fmt.Errorf("failure rate must be in (0, 1] range; got %v", cs.FailureRate)
+	}
+	if cs.FailureRate > 0 {
+		cfg.failureRate = cs.FailureRate
+	}
+	if cs.MinRequests < 0 {
+		return cfg, fmt.Errorf("min requests can't be negative; got %d", cs.MinRequests)
+	}
+	if cs.MinRequests > 0 {
+		cfg.minRequests = cs.MinRequests
+	}
+	if cs.HalfOpenRequests < 0 {
+		return cfg, fmt.Errorf("half-open requests can't be negative; got %d", cs.HalfOpenRequests)
+	}
+	if cs.HalfOpenRequests > 0 {
+		cfg.halfOpenRequests = cs.HalfOpenRequests
+	}
+
+	var err error
+	cfg.window, err = parseDurationSetting("circuit breaker window", cs.Window, defaultCBWindow)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.openTimeout, err = parseDurationSetting("circuit breaker open timeout", cs.OpenTimeout, defaultCBOpenTimeout)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitClosed:
+		return "closed"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+// circuitBreaker tracks the results of requests to the VictoriaLogs endpoint.
+// It opens after too many failed requests and rejects all requests until
+// the open timeout passes. After that, a limited number of probe requests
+// is allowed in half-open state. The circuit breaker is closed again
+// if probe requests succeed, otherwise it is opened once more.
+type circuitBreaker struct {
+	mu  sync.Mutex
+	cfg circuitBreakerConfig
+
+	state circuitState
+	// generation is changed on every state change,
+	// so results of requests started in the previous state are ignored
+	generation uint64
+	openedAt   time.Time
+	lastErr    error
+
+	// closed state counters
+	consecutiveFailures int
+	windowStart         time.Time
+	requests            int
+	failures            int
+
+	// half-open state counters
+	probes         int
+	probeSuccesses int
+
+	stateGauge prometheus.Gauge
+	rejected   prometheus.Counter
+	// now is used in tests
+	now func() time.Time
+}
+
+// newCircuitBreaker returns a new circuitBreaker in closed state
+func newCircuitBreaker(cfg circuitBreakerConfig, stateGauge prometheus.Gauge, rejected prometheus.Counter) *circuitBreaker {
+	cb := &circuitBreaker{
+		cfg:        cfg,
+		stateGauge: stateGauge,
+		rejected:   rejected,
+		now:        time.Now,
+	}
+	cb.stateGauge.Set(float64(circuitClosed))
+	return cb
+}
+
+// allow checks if the request can be sent. If it can, the returned function
+// must be called with the result of the request.
+func (cb *circuitBreaker) allow() (func(err error), error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := cb.now()
+	if cb.state == circuitOpen {
+		if now.Sub(cb.openedAt) < cb.cfg.openTimeout {
+			cb.rejected.Inc()
+			retryIn := cb.cfg.openTimeout - now.Sub(cb.openedAt)
+			return nil, fmt.Errorf("%w after too many failed requests, next attempt in %s; last error: %s",
+				errCircuitOpen, retryIn.Truncate(time.Second), cb.lastErr)
+		}
+		cb.setState(circuitHalfOpen, now)
+	}
+	if cb.state == circuitHalfOpen {
+		if cb.probes >= cb.cfg.halfOpenRequests {
+			cb.rejected.Inc()
+			return nil, fmt.Errorf("%w, waiting for the result of probe requests; last error: %s", errCircuitOpen, cb.lastErr)
+		}
+		cb.probes++
+	}
+
+	generation := cb.generation
+	return func(err error) {
+		cb.done(generation, err)
+	}, nil
+}
+
+// done registers the result of the request
+func (cb *circuitBreaker) done(generation uint64, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if generation != cb.generation {
+		return
+	}
+	now := cb.now()
+	failed, counted := isCircuitBreakerFailure(err)
+	switch cb.state {
+	case circuitHalfOpen:
+		switch {
+		case !counted:
+			// let another probe request to check the endpoint
+			cb.probes--
+		case failed:
+			cb.lastErr = err
+			cb.setState(circuitOpen, now)
+		default:
+			cb.probeSuccesses++
+			if cb.probeSuccesses >= cb.cfg.halfOpenRequests {
+				cb.setState(circuitClosed, now)
+			}
+		}
+	case circuitClosed:
+		if !counted {
+			return
+		}
+		if now.Sub(cb.windowStart) >= cb.cfg.window {
+			cb.windowStart = now
+			cb.requests, cb.failures = 0, 0
+		}
+		cb.requests++
+		if !failed {
+			cb.consecutiveFailures = 0
+			return
+		}
+		cb.failures++
+		cb.consecutiveFailures++
+		cb.lastErr = err
+		if cb.consecutiveFailures >= cb.cfg.failureThreshold ||
+			(cb.requests >= cb.cfg.minRequests && float64(cb.failures)/float64(cb.requests) >= cb.cfg.failureRate) {
+			cb.setState(circuitOpen, now)
+		}
+	}
+}
+
+// setState switches the circuit breaker to the given state and resets counters
+func (cb *circuitBreaker) setState(state circuitState, now time.Time) {
+	cb.state = state
+	cb.generation++
+	cb.consecutiveFailures, cb.requests, cb.failures = 0, 0, 0
+	cb.windowStart = now
+	cb.probes, cb.probeSuccesses = 0, 0
+	if state == circuitOpen {
+		cb.openedAt = now
+	}
+	cb.stateGauge.Set(float64(state))
+}
+
+// status returns the current state of the circuit breaker and the last registered error
+func (cb *circuitBreaker) status() (circuitState, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state, cb.lastErr
+}
+
+// isCircuitBreakerFailure checks if the request failed because of the datasource.
+// Errors caused by the request itself, like invalid query or canceled context,
+// are not counted by the circuit breaker.
+func isCircuitBreakerFailure(err error) (failed bool, counted bool) {
+	if err == nil {
+		return false, true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, errQueueTimeout) || errors.Is(err, errCallerInterrupted) {
+		return false, false
+	}
+	var se *responseStatusError
+	if errors.As(err, &se) {
+		return se.statusCode == http.StatusTooManyRequests || se.statusCode >= http.StatusInternalServerError, true
+	}
+	return true, true
+}
+
+// circuitBreakers holds circuit breakers for every VictoriaLogs endpoint of the datasource
+type circuitBreakers struct {
+	mu            sync.Mutex
+	datasourceUID string
+	cfg           circuitBreakerConfig
+	breakers      map[string]*circuitBreaker
+}
+
+// newCircuitBreakers returns a new circuitBreakers for the datasource
+func newCircuitBreakers(datasourceUID string, cfg circuitBreakerConfig) *circuitBreakers {
+	return &circuitBreakers{
+		datasourceUID: datasourceUID,
+		cfg:           cfg,
+		breakers:      make(map[string]*circuitBreaker),
+	}
+}
+
+// get returns the circuit breaker for the endpoint of the request url
+func (cbs *circuitBreakers) get(reqURL string) *circuitBreaker {
+	endpoint := reqURL
+	if u, err := url.Parse(reqURL); err == nil {
+		endpoint = u.Path
+	}
+
+	cbs.mu.Lock()
+	defer cbs.mu.Unlock()
+	cb, ok := cbs.breakers[endpoint]
+	if !ok {
+		cb = newCircuitBreaker(cbs.cfg,
+			circuitBreakerState.WithLabelValues(cbs.datasourceUID, endpoint),
+			circuitBreakerRejected.WithLabelValues(cbs.datasourceUID, endpoint))
+		cbs.breakers[endpoint] = cb
+	}
+	return cb
+}
+
+// circuitBreakerStatus contains the state of the circuit breaker for the endpoint
+type circuitBreakerStatus struct {
+	Endpoint  string `json:"endpoint"`
+	State     string `json:"state"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// statuses returns the states of all circuit breakers sorted by endpoint
+func (cbs *circuitBreakers) statuses() []circuitBreakerStatus {
+	cbs.mu.Lock()
+	defer cbs.mu.Unlock()
+
+	statuses := make([]circuitBreakerStatus, 0, len(cbs.breakers))
+	for endpoint, cb := range cbs.breakers {
+		state, lastErr := cb.status()
+		s := circuitBreakerStatus{Endpoint: endpoint, State: state.String()}
+		if state != circuitClosed && lastErr != nil {
+			s.LastError = lastErr.Error()
+		}
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Endpoint < statuses[j].Endpoint
+	})
+	return statuses
+}
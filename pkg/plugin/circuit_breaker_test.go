@@ -0,0 +1,246 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newTestCircuitBreaker(cfg circuitBreakerConfig, now *time.Time) *circuitBreaker {
+	cb := newCircuitBreaker(cfg, prometheus.NewGauge(prometheus.GaugeOpts{Name: "state"}), prometheus.NewCounter(prometheus.CounterOpts{Name: "rejected"}))
+	cb.now = func() time.Time { return *now }
+	return cb
+}
+
+func TestCircuitBreaker_consecutiveFailures(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := newTestCircuitBreaker(circuitBreakerConfig{
+		failureThreshold: 3,
+		failureRate:      1,
+		minRequests:      100,
+		window:           time.Minute,
+		openTimeout:      10 * time.Second,
+		halfOpenRequests: 1,
+	}, &now)
+
+	failure := &responseStatusError{statusCode: http.StatusServiceUnavailable, err: fmt.Errorf("got unexpected response status code: 503")}
+	f := func(err error) {
+		t.Helper()
+		done, aErr := cb.allow()
+		if aErr != nil {
+			t.Fatalf("unexpected error: %s", aErr)
+		}
+		done(err)
+	}
+	expectState := func(want circuitState) {
+		t.Helper()
+		if got, _ := cb.status(); got != want {
+			t.Fatalf("expected state %s; got %s", want, got)
+		}
+	}
+
+	f(failure)
+	f(failure)
+	// success resets the consecutive failures
+	f(nil)
+	f(failure)
+	f(failure)
+	// client errors, canceled and interrupted by the caller requests aren't counted as failures
+	f(&responseStatusError{statusCode: http.StatusBadRequest, err: fmt.Errorf("bad query")})
+	f(context.Canceled)
+	f(errCallerInterrupted)
+	expectState(circuitClosed)
+
+	f(failure)
+	f(failure)
+	f(failure)
+	expectState(circuitOpen)
+
+	_, err := cb.allow()
+	if !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected circuit open error; got %v", err)
+	}
+	if !strings.Contains(err.Error(), "got unexpected response status code: 503") {
+		t.Fatalf("expected the last error in message; got %q", err)
+	}
+
+	// the first request after the open timeout is a probe
+	now = now.Add(10 * time.Second)
+	done, err := cb.allow()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectState(circuitHalfOpen)
+	if _, err := cb.allow(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected circuit open error for the second probe; got %v", err)
+	}
+	done(failure)
+	expectState(circuitOpen)
+
+	now = now.Add(10 * time.Second)
+	done, err = cb.allow()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	done(nil)
+	expectState(circuitClosed)
+}
+
+func TestCircuitBreaker_failureRate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := newTestCircuitBreaker(circuitBreakerConfig{
+		failureThreshold: 100,
+		failureRate:      0.5,
+		minRequests:      4,
+		window:           time.Minute,
+		openTimeout:      10 * time.Second,
+		halfOpenRequests: 1,
+	}, &now)
+
+	f := func(err error) {
+		t.Helper()
+		done, aErr := cb.allow()
+		if aErr != nil {
+			t.Fatalf("unexpected error: %s", aErr)
+		}
+		done(err)
+	}
+
+	failure := errors.New("connection refused")
+	f(failure)
+	f(nil)
+	f(failure)
+	// the window is over, so counters are reset
+	now = now.Add(time.Minute)
+	f(nil)
+	f(failure)
+	f(nil)
+	if got, _ := cb.status(); got != circuitClosed {
+		t.Fatalf("expected state %s; got %s", circuitClosed, got)
+	}
+	f(failure)
+	if got, _ := cb.status(); got != circuitOpen {
+		t.Fatalf("expected state %s; got %s", circuitOpen, got)
+	}
+}
+
+func TestCircuitBreaker_staleResults(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := newTestCircuitBreaker(circuitBreakerConfig{
+		failureThreshold: 1,
+		failureRate:      1,
+		minRequests:      100,
+		window:           time.Minute,
+		openTimeout:      10 * time.Second,
+		halfOpenRequests: 1,
+	}, &now)
+
+	slow, err := cb.allow()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	failed, err := cb.allow()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	failed(errors.New("connection refused"))
+
+	// the result of the request started before opening is ignored
+	slow(nil)
+	if got, _ := cb.status(); got != circuitOpen {
+		t.Fatalf("expected state %s; got %s", circuitOpen, got)
+	}
+}
+
+func TestCircuitBreakerSettings_parse(t *testing.T) {
+	f := func(cs CircuitBreakerSettings, wantErr bool) {
+		t.Helper()
+		_, err := cs.parse()
+		if (err != nil) != wantErr {
+			t.Fatalf("expected error %v; got %v", wantErr, err)
+		}
+	}
+
+	f(CircuitBreakerSettings{}, false)
+	if cfg, _ := (CircuitBreakerSettings{}).parse(); cfg.enabled {
+		t.Fatalf("circuit breaker must be disabled by default")
+	}
+	f(CircuitBreakerSettings{FailureThreshold: 10, FailureRate: 0.2, MinRequests: 5, Window: "5m", OpenTimeout: "1m", HalfOpenRequests: 2}, false)
+	f(CircuitBreakerSettings{FailureThreshold: -1}, true)
+	f(CircuitBreakerSettings{FailureRate: 1.5}, true)
+	f(CircuitBreakerSettings{MinRequests: -1}, true)
+	f(CircuitBreakerSettings{HalfOpenRequests: -1}, true)
+	f(CircuitBreakerSettings{Window: "abc"}, true)
+	f(CircuitBreakerSettings{OpenTimeout: "-1s"}, true)
+}
+
+func TestDatasource_circuitBreaker(t *testing.T) {
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		UID: "circuit-breaker",
+		URL: srv.URL,
+		JSONData: []byte(`{
+			"retryPolicy":{"maxAttempts":1},
+			"circuitBreaker":{"enabled":true,"failureThreshold":2,"openTimeout":"1m"}
+		}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+	defer ds.Dispose()
+
+	q := &Query{
+		DataQuery: backend.DataQuery{RefID: "A"},
+		Expr:      "*",
+		QueryType: QueryTypeInstant,
+	}
+	for i := 0; i < 2; i++ {
+		rsp := ds.query(context.Background(), q)
+		if rsp.Error == nil || !strings.Contains(rsp.Error.Error(), "503") {
+			t.Fatalf("expected 503 error; got %v", rsp.Error)
+		}
+	}
+
+	rsp := ds.query(context.Background(), q)
+	if !errors.Is(rsp.Error, errCircuitOpen) {
+		t.Fatalf("expected circuit open error; got %v", rsp.Error)
+	}
+	if requests.Load() != 2 {
+		t.Fatalf("expected 2 requests to the datasource; got %d", requests.Load())
+	}
+
+	res, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if res.Status != backend.HealthStatusOk {
+		t.Fatalf("expected status %s; got %s", backend.HealthStatusOk, res.Status)
+	}
+	if !strings.Contains(res.Message, "/select/logsql/query (open)") {
+		t.Fatalf("expected circuit breaker state in message; got %q", res.Message)
+	}
+	if !strings.Contains(string(res.JSONDetails), `"state":"open"`) {
+		t.Fatalf("expected circuit breaker state in details; got %s", res.JSONDetails)
+	}
+}
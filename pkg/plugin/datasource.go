@@ -10,18 +10,23 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/VictoriaMetrics/victorialogs-datasource/pkg/utils"
 )
 
 var (
 	_ backend.StreamHandler         = &Datasource{}
 	_ backend.QueryDataHandler      = &Datasource{}
 	_ backend.CheckHealthHandler    = &Datasource{}
+	_ backend.CallResourceHandler   = &Datasource{}
 	_ instancemgmt.InstanceDisposer = &Datasource{}
 )
 
@@ -41,10 +46,19 @@ func NewDatasource(ctx context.Context, settings backend.DataSourceInstanceSetti
 	if err != nil {
 		return nil, fmt.Errorf("error create httpclient.Options based on settings: %w", err)
 	}
-	opts.ForwardHTTPHeaders = true
+	grafanaSettings, err := NewGrafanaSettings(settings)
+	if err != nil {
+		return nil, fmt.Errorf("error create a new GrafanaSettings: %w", err)
+	}
+
+	// headers of the Grafana request are filtered according to the forwarding settings
+	// and are set to every request to the datasource, see requestHeaders
+	opts.ForwardHTTPHeaders = false
 	for key := range opts.Header {
-		if key == "" {
-			opts.Header.Del(key)
+		// tenant headers are set per request, since the tenant can be overridden by the query,
+		// so they must not be overwritten by the custom headers middleware of the http client
+		if key == "" || isTenantHeader(key) {
+			delete(opts.Header, key)
 		}
 	}
 
@@ -53,17 +67,24 @@ func NewDatasource(ctx context.Context, settings backend.DataSourceInstanceSetti
 		return nil, fmt.Errorf("error create a new http.Client: %w", err)
 	}
 
-	grafanaSettings, err := NewGrafanaSettings(settings)
-	if err != nil {
-		return nil, fmt.Errorf("error create a new GrafanaSettings: %w", err)
-	}
-
-	return &Datasource{
+	ds := &Datasource{
 		settings:          settings,
 		httpClient:        cl,
 		liveModeResponses: sync.Map{},
 		grafanaSettings:   grafanaSettings,
-	}, nil
+		limiter:           newRequestLimiter(grafanaSettings.MaxConcurrentRequests, grafanaSettings.queueTimeout),
+		metrics:           newDatasourceMetrics(settings.UID),
+	}
+	if grafanaSettings.CacheSize > 0 {
+		ds.resultCache = newResultCache(settings.UID, grafanaSettings.CacheSize, grafanaSettings.cacheTTL)
+	}
+	if grafanaSettings.ExtentCacheSize > 0 {
+		ds.extentCache = newExtentCache(settings.UID, grafanaSettings.ExtentCacheSize)
+	}
+	if grafanaSettings.circuitBreaker.enabled {
+		ds.circuitBreakers = newCircuitBreakers(settings.UID, grafanaSettings.circuitBreaker)
+	}
+	return ds, nil
 }
 
 // GrafanaSettings contains the raw DataSourceConfig as JSON as stored by Grafana server.
@@ -72,6 +93,88 @@ type GrafanaSettings struct {
 	HTTPMethod    string      `json:"httpMethod"`
 	QueryParams   string      `json:"customQueryParameters"`
 	CustomHeaders http.Header `json:"-"`
+
+	// SplitInterval defines the interval by which the time range of the log query
+	// is split into several queries. Splitting is disabled if the value is empty.
+	SplitInterval string `json:"splitInterval"`
+	// SplitConcurrency defines the max number of concurrently executed split queries
+	SplitConcurrency int `json:"splitConcurrency"`
+
+	// CacheSize defines the max number of responses of stats and hits queries
+	// kept in the result cache. The cache is disabled if the value is zero.
+	CacheSize int `json:"resultCacheSize"`
+	// CacheTTL defines how long the response is kept in the result cache
+	CacheTTL string `json:"resultCacheTTL"`
+
+	// ExtentCacheSize defines the max number of stats range and hits queries
+	// which closed buckets are kept in the extent cache. The cache is disabled if the value is zero.
+	ExtentCacheSize int `json:"extentCacheSize"`
+	// ExtentCacheFreshness defines the window before now, which buckets are not cached,
+	// since they still can be changed by late-arriving logs
+	ExtentCacheFreshness string `json:"extentCacheFreshness"`
+
+	// MaxConcurrentRequests defines the max number of concurrent requests to the datasource
+	MaxConcurrentRequests int `json:"maxConcurrentRequests"`
+	// QueueTimeout defines how long the request waits for a free slot
+	// if the max number of concurrent requests is reached
+	QueueTimeout string `json:"queueTimeout"`
+
+	// RetryPolicy defines how the failed requests of interactive queries are retried
+	RetryPolicy RetrySettings `json:"retryPolicy"`
+	// AlertingRetryPolicy defines how the failed requests of alerting queries are retried
+	AlertingRetryPolicy RetrySettings `json:"alertingRetryPolicy"`
+
+	// AccountID and ProjectID define the tenant of VictoriaLogs cluster, which is used
+	// for all requests to the datasource. The values of AccountID and ProjectID
+	// custom headers are used if they aren't set.
+	AccountID string `json:"accountID"`
+	ProjectID string `json:"projectID"`
+	// AllowedTenants contains comma-separated list of tenants in AccountID:ProjectID format,
+	// which can be set in the query instead of the datasource tenant
+	AllowedTenants string `json:"allowedTenants"`
+	// TenantMapping maps Grafana organizations, roles and users to tenants.
+	// If it is set, requests of users which aren't mapped to any tenant are rejected.
+	TenantMapping []TenantMappingRule `json:"tenantMapping"`
+
+	// ExtraFilters and ExtraStreamFilters are set as extra_filters and extra_stream_filters args
+	// of all requests to the datasource, so users can't query logs outside these filters.
+	// They can contain variables of the Grafana user, e.g. ${__user.login} or ${__org.id}.
+	ExtraFilters       string `json:"extraFilters"`
+	ExtraStreamFilters string `json:"extraStreamFilters"`
+
+	// IdentityToken defines the signed identity auth mode, where requests contain
+	// JWT with the identity of the Grafana user signed with the key from secure json data
+	IdentityToken IdentityTokenSettings `json:"identityToken"`
+
+	// HeaderForwarding defines which headers of the Grafana request are forwarded to the datasource
+	HeaderForwarding HeaderForwardingSettings `json:"headerForwarding"`
+
+	// LogsVolumeLevelField defines the field which groups hits of the logs volume query by log level
+	LogsVolumeLevelField string `json:"logsVolumeLevelField"`
+	// DetectedLevelFields contains fields of log lines, which are checked in order
+	// to detect the level of the log line. The message is checked if the level isn't found in the fields.
+	DetectedLevelFields []string `json:"detectedLevelFields"`
+	// FlattenNestedFields flattens nested objects of log lines into fields with dotted keys,
+	// e.g. {"http":{"status":200}} into http.status field. Nested objects are kept as JSON text otherwise.
+	FlattenNestedFields bool `json:"flattenNestedFields"`
+
+	// CircuitBreaker defines when requests to the datasource endpoints are rejected
+	// after too many failures. The circuit breaker is disabled by default.
+	CircuitBreaker CircuitBreakerSettings `json:"circuitBreaker"`
+
+	splitInterval        time.Duration
+	cacheTTL             time.Duration
+	extentCacheFreshness time.Duration
+	queueTimeout         time.Duration
+	retryPolicy          retryPolicy
+	alertingRetryPolicy  retryPolicy
+	circuitBreaker       circuitBreakerConfig
+	tenant               tenantID
+	allowedTenants       map[tenantID]struct{}
+	tenantMapping        []TenantMappingRule
+	identitySigner       *identitySigner
+	headerFilter         *headerFilter
+	levelDetector        *levelDetector
 }
 
 func NewGrafanaSettings(settings backend.DataSourceInstanceSettings) (*GrafanaSettings, error) {
@@ -90,9 +193,100 @@ func NewGrafanaSettings(settings backend.DataSourceInstanceSettings) (*GrafanaSe
 	if grafanaSettings.HTTPMethod == "" {
 		grafanaSettings.HTTPMethod = http.MethodPost
 	}
+	if grafanaSettings.LogsVolumeLevelField == "" {
+		grafanaSettings.LogsVolumeLevelField = defaultLogsVolumeLevelField
+	}
+	grafanaSettings.levelDetector = newLevelDetector(grafanaSettings.DetectedLevelFields)
+
+	grafanaSettings.splitInterval, err = parseDurationSetting("split interval", grafanaSettings.SplitInterval, 0)
+	if err != nil {
+		return nil, err
+	}
+	if grafanaSettings.SplitConcurrency <= 0 {
+		grafanaSettings.SplitConcurrency = defaultSplitConcurrency
+	}
+
+	grafanaSettings.cacheTTL, err = parseDurationSetting("result cache ttl", grafanaSettings.CacheTTL, defaultCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	grafanaSettings.extentCacheFreshness, err = parseDurationSetting("extent cache freshness", grafanaSettings.ExtentCacheFreshness, defaultExtentCacheFreshness)
+	if err != nil {
+		return nil, err
+	}
+
+	if grafanaSettings.MaxConcurrentRequests <= 0 {
+		grafanaSettings.MaxConcurrentRequests = defaultMaxConcurrentRequests
+	}
+	grafanaSettings.queueTimeout, err = parseDurationSetting("queue timeout", grafanaSettings.QueueTimeout, defaultQueueTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	grafanaSettings.retryPolicy, err = grafanaSettings.RetryPolicy.parse(defaultRetryPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse retry policy: %w", err)
+	}
+	grafanaSettings.alertingRetryPolicy, err = grafanaSettings.AlertingRetryPolicy.parse(defaultAlertingRetryPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse alerting retry policy: %w", err)
+	}
+	grafanaSettings.circuitBreaker, err = grafanaSettings.CircuitBreaker.parse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse circuit breaker settings: %w", err)
+	}
+	grafanaSettings.tenant, grafanaSettings.allowedTenants, err = parseTenantSettings(grafanaSettings.AccountID,
+		grafanaSettings.ProjectID, grafanaSettings.AllowedTenants, grafanaSettings.CustomHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tenant settings: %w", err)
+	}
+	grafanaSettings.tenantMapping, err = parseTenantMapping(grafanaSettings.TenantMapping)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tenant mapping: %w", err)
+	}
+	if err := validateExtraFiltersTemplate(grafanaSettings.ExtraFilters); err != nil {
+		return nil, fmt.Errorf("failed to parse extra filters: %w", err)
+	}
+	if err := validateExtraFiltersTemplate(grafanaSettings.ExtraStreamFilters); err != nil {
+		return nil, fmt.Errorf("failed to parse extra stream filters: %w", err)
+	}
+	grafanaSettings.identitySigner, err = grafanaSettings.IdentityToken.parse(settings.DecryptedSecureJSONData[identityTokenKeyName])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity token settings: %w", err)
+	}
+	// basic auth middleware of the SDK overwrites the Authorization header with the token
+	if is := grafanaSettings.identitySigner; is != nil && settings.BasicAuthEnabled && is.header == defaultIdentityTokenHeader {
+		return nil, fmt.Errorf("failed to parse identity token settings: %s header is used by basic auth; set another header of the token", is.header)
+	}
+	// the signed identity replaces the forwarded headers of the Grafana request,
+	// so the datasource doesn't receive cookies and tokens of the user by default
+	defaultForwardingMode := headerForwardingAll
+	if grafanaSettings.identitySigner != nil {
+		defaultForwardingMode = headerForwardingNone
+	}
+	grafanaSettings.headerFilter, err = grafanaSettings.HeaderForwarding.parse(defaultForwardingMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse header forwarding settings: %w", err)
+	}
 	return &grafanaSettings, nil
 }
 
+// parseDurationSetting parses the duration from the datasource setting.
+// It returns defaultValue if the setting is empty.
+func parseDurationSetting(name, value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := utils.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s %q: %w", name, value, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s can't be negative; got %q", name, value)
+	}
+	return d, nil
+}
+
 // Datasource is an example datasource which can respond to data queries, reports
 // its health and has streaming skills.
 type Datasource struct {
@@ -101,6 +295,11 @@ type Datasource struct {
 	httpClient        *http.Client
 	liveModeResponses sync.Map
 	grafanaSettings   *GrafanaSettings
+	resultCache       *lruCache
+	extentCache       *lruCache
+	limiter           *requestLimiter
+	circuitBreakers   *circuitBreakers
+	metrics           *datasourceMetrics
 }
 
 // SubscribeStream called when a user tries to subscribe to a plugin/datasource
@@ -108,6 +307,17 @@ type Datasource struct {
 // options with Grafana Core. As soon as first subscriber joins channel RunStream
 // will be called.
 func (d *Datasource) SubscribeStream(_ context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	_, err := d.grafanaSettings.userTenant(req.PluginContext)
+	if err == nil {
+		_, err = d.grafanaSettings.extraFilters(req.PluginContext)
+	}
+	if err != nil {
+		log.DefaultLogger.Warn("live tailing is rejected", "err", err.Error())
+		return &backend.SubscribeStreamResponse{
+			Status: backend.SubscribeStreamStatusPermissionDenied,
+		}, nil
+	}
+
 	ch := make(chan *data.Frame, 1)
 	d.liveModeResponses.Store(req.Path, ch)
 
@@ -185,6 +395,12 @@ func (d *Datasource) Dispose() {
 	})
 	// clear the map
 	d.liveModeResponses.Clear()
+	if d.resultCache != nil {
+		d.resultCache.reset()
+	}
+	if d.extentCache != nil {
+		d.extentCache.reset()
+	}
 }
 
 // QueryData handles multiple queries and returns multiple responses.
@@ -199,19 +415,47 @@ func (d *Datasource) QueryData(ctx context.Context, req *backend.QueryDataReques
 	if err != nil {
 		return nil, err
 	}
-
-	var wg sync.WaitGroup
+	forwardedHeaders := d.grafanaSettings.headerFilter.filter(req.GetHTTPHeaders())
+	// extra filters and the identity are the same for all queries of the user
+	extraFilters, extraFiltersErr := d.grafanaSettings.extraFilters(req.PluginContext)
+	identity, identityErr := d.grafanaSettings.userIdentity(req.PluginContext)
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
 	for _, q := range req.Queries {
 		rawQuery, err := d.getQueryFromRaw(q.JSON, forAlerting)
+		if err == nil {
+			err = rawQuery.validate()
+		}
+		if err == nil {
+			rawQuery.tenant, err = d.grafanaSettings.queryTenant(req.PluginContext, rawQuery.Tenant)
+		}
+		if err == nil {
+			rawQuery.extraFilters, err = extraFilters, extraFiltersErr
+		}
+		if err == nil {
+			rawQuery.identity, err = identity, identityErr
+		}
 		if err != nil {
-			return nil, err
+			// the invalid query must not fail other queries of the request
+			mu.Lock()
+			response.Responses[q.RefID] = newQueryErrorResponse(q.RefID, err)
+			mu.Unlock()
+			continue
 		}
 		rawQuery.DataQuery = q
+		rawQuery.forwardedHeaders = forwardedHeaders
 
 		wg.Add(1)
 		go func(rawQuery *Query) {
 			defer wg.Done()
-			response.Responses[rawQuery.RefID] = d.query(ctx, req.PluginContext, rawQuery)
+			rsp := d.query(ctx, rawQuery)
+
+			mu.Lock()
+			response.Responses[rawQuery.RefID] = rsp
+			mu.Unlock()
 		}(rawQuery)
 	}
 	wg.Wait()
@@ -225,6 +469,18 @@ func (d *Datasource) streamQuery(ctx context.Context, request *backend.RunStream
 	if err != nil {
 		return err
 	}
+	q.tenant, err = d.grafanaSettings.queryTenant(request.PluginContext, q.Tenant)
+	if err != nil {
+		return err
+	}
+	q.extraFilters, err = d.grafanaSettings.extraFilters(request.PluginContext)
+	if err != nil {
+		return err
+	}
+	q.identity, err = d.grafanaSettings.userIdentity(request.PluginContext)
+	if err != nil {
+		return err
+	}
 
 	r, err := d.datasourceQuery(ctx, q, true)
 	if err != nil {
@@ -237,7 +493,9 @@ func (d *Datasource) streamQuery(ctx context.Context, request *backend.RunStream
 	}
 
 	livestream := ch.(chan *data.Frame)
-	return parseStreamResponse(r, livestream)
+	d.metrics.activeStreams.Inc()
+	defer d.metrics.activeStreams.Dec()
+	return parseStreamResponse(r, livestream, d.metrics.lines, d.grafanaSettings.logsParseOptions())
 }
 
 // getQueryFromRaw parses the query json from the raw message.
@@ -247,66 +505,270 @@ func (d *Datasource) getQueryFromRaw(data json.RawMessage, forAlerting bool) (*Q
 		return nil, fmt.Errorf("failed to parse query json: %s", err)
 	}
 	q.ForAlerting = forAlerting
+	if q.isLogsVolume() {
+		// logs volume is the number of hits grouped by the level field
+		q.QueryType = QueryTypeHits
+		q.Field = d.grafanaSettings.LogsVolumeLevelField
+	}
 	return &q, nil
 }
 
 // datasourceQuery process the query to the datasource and returns the result.
 func (d *Datasource) datasourceQuery(ctx context.Context, q *Query, isStream bool) (io.ReadCloser, error) {
-	reqURL, err := q.getQueryURL(d.settings.URL, d.grafanaSettings.QueryParams)
+	reqURL, err := d.buildQueryURL(ctx, q, isStream)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request URL: %w", err)
+		return nil, err
 	}
 
 	if isStream {
-		reqURL, err = q.queryTailURL(d.settings.URL, d.grafanaSettings.QueryParams)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request URL: %w", err)
-		}
+		// tail requests are long-living, so they must not hold the slots of the limiter
+		return d.doRequest(ctx, reqURL, d.queryHeaders(q), false, false)
 	}
+	return d.sendRequest(ctx, reqURL, d.queryHeaders(q), q.ForAlerting)
+}
+
+// buildQueryURL builds the url of the request to the datasource for the query
+func (d *Datasource) buildQueryURL(ctx context.Context, q *Query, isStream bool) (string, error) {
+	_, span := startSpan(ctx, "victorialogs.build_url", queryAttributes(q)...)
+	defer span.End()
 
-	req, err := http.NewRequestWithContext(ctx, d.grafanaSettings.HTTPMethod, reqURL, nil)
+	var reqURL string
+	var err error
+	if isStream {
+		reqURL, err = q.queryTailURL(d.settings.URL, d.grafanaSettings.QueryParams)
+	} else {
+		reqURL, err = q.getQueryURL(d.settings.URL, d.grafanaSettings.QueryParams)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new request with context: %w", err)
+		err = fmt.Errorf("failed to create request URL: %w", err)
+		_ = tracing.Error(span, err)
+		return "", err
 	}
-	req.Header = d.grafanaSettings.CustomHeaders.Clone()
+	return reqURL, nil
+}
+
+// sendRequest sends the request to the datasource if the limit of concurrent
+// requests isn't reached. The slot of the limiter is released when the returned
+// response body is closed.
+func (d *Datasource) sendRequest(ctx context.Context, reqURL string, headers http.Header, forAlerting bool) (io.ReadCloser, error) {
+	return d.doRequest(ctx, reqURL, headers, forAlerting, true)
+}
 
-	resp, err := d.httpClient.Do(req)
+// doRequest sends the request to the datasource if the circuit breaker
+// of the requested endpoint allows it.
+func (d *Datasource) doRequest(ctx context.Context, reqURL string, headers http.Header, forAlerting, limited bool) (io.ReadCloser, error) {
+	if d.circuitBreakers == nil {
+		return d.doRequestWithRetries(ctx, reqURL, headers, forAlerting, limited)
+	}
+
+	done, err := d.circuitBreakers.get(reqURL).allow()
 	if err != nil {
-		if !isTrivialError(err) {
-			// Return unexpected error to the caller.
-			return nil, err
+		return nil, err
+	}
+	body, err := d.doRequestWithRetries(ctx, reqURL, headers, forAlerting, limited)
+	if err != nil && ctx.Err() != nil {
+		// the deadline or cancellation of the caller says nothing about the endpoint health
+		done(errCallerInterrupted)
+	} else {
+		done(err)
+	}
+	return body, err
+}
+
+// acquireSlot waits for a free slot of the limiter if the request is limited
+// and returns the function which releases it
+func (d *Datasource) acquireSlot(ctx context.Context, limited bool) (func(), error) {
+	if d.limiter == nil || !limited {
+		return func() {}, nil
+	}
+	return d.limiter.acquire(ctx)
+}
+
+// doRequestWithRetries sends the request to the datasource with the given
+// headers and returns the response body if the request succeeded.
+// Failed requests are retried according to the retry policy. The slot of the limiter
+// is acquired for every attempt, so it isn't held while waiting for the next attempt.
+func (d *Datasource) doRequestWithRetries(ctx context.Context, reqURL string, headers http.Header, forAlerting, limited bool) (body io.ReadCloser, err error) {
+	policy := d.grafanaSettings.retryPolicy
+	if forAlerting {
+		policy = d.grafanaSettings.alertingRetryPolicy
+	}
+
+	// the request is sent with the context of the span, so its trace context
+	// is propagated to the datasource in the request headers
+	ctx, span := startSpan(ctx, "victorialogs.request", attrTenant.String(tenantFromHeaders(headers)))
+	var attempt int
+	var resp *http.Response
+	defer func() {
+		span.SetAttributes(attrRetries.Int(attempt - 1))
+		if resp != nil {
+			span.SetAttributes(attrStatusCode.Int(resp.StatusCode))
 		}
+		if err != nil {
+			_ = tracing.Error(span, err)
+		}
+		span.End()
+	}()
 
-		// Something in the middle between client and datasource might be closing
-		// the connection. So we do a one more attempt in hope request will succeed.
-		req, err = http.NewRequestWithContext(ctx, d.grafanaSettings.HTTPMethod, reqURL, nil)
+	if isDebugEnabled() {
+		log.DefaultLogger.Debug("sending request to the datasource", "url", reqURL, "headers", redactHeaders(headers))
+	}
+
+	var release func()
+	for attempt = 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, d.grafanaSettings.HTTPMethod, reqURL, nil)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create new request with context: %w", err)
 		}
+		req.Header = headers.Clone()
+
+		release, err = d.acquireSlot(ctx, limited)
+		if err != nil {
+			return nil, err
+		}
+		if limited {
+			// tail requests are long-living, so they are tracked by active streams instead
+			d.metrics.inflight.Inc()
+			releaseSlot := release
+			release = func() {
+				releaseSlot()
+				d.metrics.inflight.Dec()
+			}
+		}
 
-		req.Header = d.grafanaSettings.CustomHeaders.Clone()
+		var reason string
+		var delay time.Duration
 		resp, err = d.httpClient.Do(req)
 		if err != nil {
+			d.metrics.countResponse(0)
+			release()
+			if !isTrivialError(err) {
+				// Return unexpected error to the caller.
+				return nil, err
+			}
+			if attempt >= policy.maxAttempts || !isIdempotentRequest(req) {
+				return nil, fmt.Errorf("failed to make http request: %w", err)
+			}
+			// Something in the middle between client and datasource might be closing
+			// the connection. So we do one more attempt in hope request will succeed.
+			reason = err.Error()
+			delay = policy.backoff(attempt)
+		} else {
+			d.metrics.countResponse(resp.StatusCode)
+			if !isRetryableStatusCode(resp.StatusCode) || attempt >= policy.maxAttempts || !isIdempotentRequest(req) {
+				break
+			}
+			delay = policy.backoff(attempt)
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if !canWaitForRetry(ctx, retryAfter, policy) {
+					// the datasource asks to wait longer than allowed,
+					// so return its response instead of retrying earlier
+					break
+				}
+				delay = retryAfter
+			}
+			reason = fmt.Sprintf("got response status code %d", resp.StatusCode)
+			drainBody(resp.Body)
+			release()
+		}
+
+		d.metrics.retries.Inc()
+		log.DefaultLogger.Warn("retrying request to the datasource",
+			"attempt", attempt, "maxAttempts", policy.maxAttempts, "reason", reason, "delay", delay.String(), "forAlerting", forAlerting)
+		if err := sleepWithContext(ctx, delay); err != nil {
 			return nil, fmt.Errorf("failed to make http request: %w", err)
 		}
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusUnprocessableEntity {
-			return nil, parseErrorResponse(resp.Body)
-		}
-		return nil, fmt.Errorf("got unexpected response status code: %d", resp.StatusCode)
+		defer release()
+		defer drainBody(resp.Body)
+		return nil, newResponseStatusError(resp.StatusCode, parseErrorResponse(resp.Body))
 	}
 
-	return resp.Body, nil
+	body = &countingReadCloser{ReadCloser: resp.Body, counter: d.metrics.responseBytes}
+	return &releaseOnClose{ReadCloser: body, release: release}, nil
 }
 
 // query sends a query to the datasource and returns the result.
-func (d *Datasource) query(ctx context.Context, _ backend.PluginContext, q *Query) backend.DataResponse {
-	r, err := d.datasourceQuery(ctx, q, false)
+func (d *Datasource) query(ctx context.Context, q *Query) backend.DataResponse {
+	defer d.metrics.observeQuery(q.QueryType, time.Now())
+	ctx, span := startSpan(ctx, "victorialogs.query", queryAttributes(q)...)
+	rsp := d.doQuery(ctx, q)
+	endSpan(span, rsp)
+	return rsp
+}
+
+// doQuery executes the query in the way defined by the datasource settings
+func (d *Datasource) doQuery(ctx context.Context, q *Query) backend.DataResponse {
+	if q.isLogsQuery() {
+		return formatLogsResponse(d.pagedQuery(ctx, q), q)
+	}
+	if d.extentCache != nil && q.isExtentCacheable() {
+		return d.extentQuery(ctx, q)
+	}
+	if d.resultCache != nil && q.isCacheable() {
+		return d.cachedQuery(ctx, q)
+	}
+	return d.directQuery(ctx, q)
+}
+
+// pagedQuery executes the log query starting from the cursor of the previous page
+// and sets the cursor of the next page to the metadata of the log frame
+func (d *Datasource) pagedQuery(ctx context.Context, q *Query) backend.DataResponse {
+	if q.MaxLines <= 0 {
+		q.MaxLines = defaultMaxLines
+	}
+	limit := q.MaxLines
+	q.cursor.apply(q)
+
+	var rsp backend.DataResponse
+	if d.shouldSplit(q) {
+		rsp = d.splitQuery(ctx, q)
+	} else {
+		rsp = d.directQuery(ctx, q)
+	}
+	if rsp.Error != nil || len(rsp.Frames) == 0 {
+		return rsp
+	}
+
+	frame, next, err := paginateLogFrame(rsp.Frames[0], q.cursor, limit)
 	if err != nil {
 		return newResponseError(err, backend.StatusInternal)
 	}
+	setLogsCursor(frame, next)
+	rsp.Frames[0] = frame
+	return rsp
+}
+
+// formatLogsResponse converts the log frame of the response into the format of the query
+func formatLogsResponse(rsp backend.DataResponse, q *Query) backend.DataResponse {
+	if rsp.Error != nil || len(rsp.Frames) == 0 {
+		return rsp
+	}
+	switch q.Format {
+	case QueryFormatAnnotations:
+		frame, err := q.Annotation.annotationsFrame(rsp.Frames[0])
+		if err != nil {
+			return newResponseError(err, backend.StatusInternal)
+		}
+		rsp.Frames[0] = frame
+	case QueryFormatTable:
+		frame, err := q.Table.tableFrame(rsp.Frames[0])
+		if err != nil {
+			return newResponseError(err, backend.StatusInternal)
+		}
+		rsp.Frames[0] = frame
+	}
+	return rsp
+}
+
+// directQuery sends the query to the datasource and parses the response
+func (d *Datasource) directQuery(ctx context.Context, q *Query) backend.DataResponse {
+	r, err := d.datasourceQuery(ctx, q, false)
+	if err != nil {
+		return newRequestErrorResponse(err)
+	}
 
 	defer func() {
 		if err := r.Close(); err != nil {
@@ -314,16 +776,49 @@ func (d *Datasource) query(ctx context.Context, _ backend.PluginContext, q *Quer
 		}
 	}()
 
+	return d.parseResponse(ctx, r, q)
+}
+
+// parseResponse parses the datasource response depending on the query type
+func (d *Datasource) parseResponse(ctx context.Context, r io.Reader, q *Query) backend.DataResponse {
+	ctx, span := startSpan(ctx, "victorialogs.parse_response", queryAttributes(q)...)
+	cr := &countingReader{r: r}
+	var rsp backend.DataResponse
 	switch q.QueryType {
 	case QueryTypeStats:
-		return parseStatsResponse(r, q)
+		rsp = parseStatsResponse(ctx, cr, q)
 	case QueryTypeStatsRange:
-		return parseStatsResponse(r, q)
+		rsp = parseStatsResponse(ctx, cr, q)
 	case QueryTypeHits:
-		return parseHitsResponse(r)
+		rsp = parseHitsResponse(ctx, cr)
+		if rsp.Error == nil && q.isLogsVolume() {
+			frames, err := logsVolumeFrames(rsp.Frames, q.Field)
+			if err != nil {
+				rsp = newResponseError(err, backend.StatusInternal)
+			} else {
+				rsp.Frames = frames
+			}
+		}
+	case QueryTypeStreams, QueryTypeStreamIDs, QueryTypeFieldNames, QueryTypeFieldValues:
+		rsp = parseValuesResponse(ctx, cr, q)
 	default:
-		return parseInstantResponse(r)
+		rsp = parseInstantResponse(cr, d.metrics.lines, d.grafanaSettings.logsParseOptions())
+		if rsp.Error == nil {
+			// VictoriaLogs doesn't sort log lines, so they are sorted by time in the query direction
+			frame, err := mergeLogFrames(rsp.Frames, 0, q.Direction)
+			if err != nil {
+				rsp = newResponseError(err, backend.StatusInternal)
+			} else {
+				rsp.Frames = data.Frames{frame}
+			}
+		}
+		if len(rsp.Frames) > 0 {
+			span.SetAttributes(attrLines.Int(rsp.Frames[0].Rows()))
+		}
 	}
+	span.SetAttributes(attrResponseBytes.Int64(cr.n))
+	endSpan(span, rsp)
+	return rsp
 }
 
 func (d *Datasource) checkAlertingRequest(headers map[string]string) (bool, error) {
@@ -347,14 +842,28 @@ func (d *Datasource) checkAlertingRequest(headers map[string]string) (bool, erro
 // The main use case for these health checks is the test button on the
 // datasource configuration page which allows users to verify that
 // a datasource is working as expected.
-func (d *Datasource) CheckHealth(ctx context.Context, _ *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
+func (d *Datasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
+	result := d.checkHealth(ctx, req)
+	if d.circuitBreakers != nil {
+		addCircuitBreakerStatuses(result, d.circuitBreakers.statuses())
+	}
+	return result, nil
+}
+
+// checkHealth checks the health endpoint of the datasource
+func (d *Datasource) checkHealth(ctx context.Context, req *backend.CheckHealthRequest) *backend.CheckHealthResult {
 	r, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s%s", strings.TrimRight(d.settings.URL, "/"), health), nil)
 	if err != nil {
-		return newHealthCheckErrorf("could not create request"), nil
+		return newHealthCheckErrorf("could not create request")
+	}
+	identity, err := d.grafanaSettings.userIdentity(req.PluginContext)
+	if err != nil {
+		return newHealthCheckErrorf("could not create identity token: %s", err)
 	}
+	r.Header = d.requestHeaders(d.grafanaSettings.tenant, identity, d.grafanaSettings.headerFilter.filter(req.GetHTTPHeaders()))
 	resp, err := d.httpClient.Do(r)
 	if err != nil {
-		return newHealthCheckErrorf("request error"), nil
+		return newHealthCheckErrorf("request error")
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
@@ -362,12 +871,35 @@ func (d *Datasource) CheckHealth(ctx context.Context, _ *backend.CheckHealthRequ
 		}
 	}()
 	if resp.StatusCode != http.StatusOK {
-		return newHealthCheckErrorf("got response code %d", resp.StatusCode), nil
+		return newHealthCheckErrorf("got response code %d", resp.StatusCode)
 	}
 	return &backend.CheckHealthResult{
 		Status:  backend.HealthStatusOk,
 		Message: "Data source is working",
-	}, nil
+	}
+}
+
+// addCircuitBreakerStatuses adds the states of circuit breakers to the health check result.
+// Endpoints with not closed circuit breakers are listed in the message.
+func addCircuitBreakerStatuses(result *backend.CheckHealthResult, statuses []circuitBreakerStatus) {
+	if len(statuses) == 0 {
+		return
+	}
+	var notClosed []string
+	for _, s := range statuses {
+		if s.State != circuitClosed.String() {
+			notClosed = append(notClosed, fmt.Sprintf("%s (%s)", s.Endpoint, s.State))
+		}
+	}
+	if len(notClosed) > 0 {
+		result.Message += fmt.Sprintf("; circuit breaker is not closed for endpoints: %s", strings.Join(notClosed, ", "))
+	}
+	details, err := json.Marshal(map[string]interface{}{"circuitBreakers": statuses})
+	if err != nil {
+		log.DefaultLogger.Error("check health: failed to marshal circuit breaker statuses", "err", err.Error())
+		return
+	}
+	result.JSONDetails = details
 }
 
 // newHealthCheckErrorf returns a new *backend.CheckHealthResult with its status set to backend.HealthStatusError
@@ -377,10 +909,29 @@ func newHealthCheckErrorf(format string, args ...interface{}) *backend.CheckHeal
 }
 
 // newResponseError returns a new backend.DataResponse with its status set to backend.DataResponse
-// and the specified error message.
+// and the specified error message. The error is considered as plugin error
+// unless its source is defined explicitly.
 func newResponseError(err error, httpStatus backend.Status) backend.DataResponse {
 	log.DefaultLogger.Error(err.Error())
-	return backend.DataResponse{Status: httpStatus, Error: err}
+	source := backend.ErrorSourcePlugin
+	var es backend.ErrorWithSource
+	if errors.As(err, &es) {
+		source = es.ErrorSource()
+	}
+	return backend.DataResponse{Status: httpStatus, Error: err, ErrorSource: source}
+}
+
+// newQueryErrorResponse returns a new backend.DataResponse for the query
+// which can't be parsed or validated. Such errors are caused by the query itself
+// or by the user who isn't allowed to query the tenant, so they are considered as downstream errors.
+func newQueryErrorResponse(refID string, err error) backend.DataResponse {
+	status := backend.StatusBadRequest
+	if errors.Is(err, errAccessForbidden) {
+		status = backend.StatusForbidden
+	}
+	err = fmt.Errorf("invalid query %q: %w", refID, err)
+	log.DefaultLogger.Warn(err.Error())
+	return backend.DataResponse{Status: status, Error: err, ErrorSource: backend.ErrorSourceDownstream}
 }
 
 // isTrivialError returns true if the err is temporary and can be retried.
@@ -22,6 +22,7 @@ func TestQueryData(t *testing.T) {
 			QueryParams:   "",
 			CustomHeaders: nil,
 		},
+		metrics: newDatasourceMetrics("test"),
 	}
 
 	resp, err := ds.QueryData(
@@ -194,7 +195,11 @@ func TestDatasourceQueryRequest(t *testing.T) {
 		b, _ := labelsToJSON(labels)
 
 		labelsField.Append(b)
-		frame := data.NewFrame("", timeFd, lineField, labelsField)
+
+		levelFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+		levelFd.Name = gDetectedLevelField
+		levelFd.Append(logLevelUnknown)
+		frame := data.NewFrame("", timeFd, lineField, labelsField, levelFd)
 
 		rsp := backend.DataResponse{}
 		frame.Meta = &data.FrameMeta{}
@@ -271,7 +276,11 @@ func TestDatasourceQueryRequest(t *testing.T) {
 		b, _ := labelsToJSON(labels)
 
 		labelsField.Append(b)
-		frame := data.NewFrame("", timeFd, lineField, labelsField)
+
+		levelFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+		levelFd.Name = gDetectedLevelField
+		levelFd.Append(logLevelUnknown)
+		frame := data.NewFrame("", timeFd, lineField, labelsField, levelFd)
 
 		rsp := backend.DataResponse{}
 		frame.Meta = &data.FrameMeta{}
@@ -411,8 +420,8 @@ func TestDatasourceQueryRequestWithRetry(t *testing.T) {
 			t.Fatalf("expected 1 frame got %d", len(response.Frames))
 		}
 		for _, frame := range response.Frames {
-			if len(frame.Fields) != 3 {
-				t.Fatalf("expected 3 fields got %d", len(frame.Fields))
+			if len(frame.Fields) != 4 {
+				t.Fatalf("expected 4 fields got %d", len(frame.Fields))
 			}
 			if frame.Fields[1].At(0) != v {
 				t.Fatalf("unexpected value %v", frame.Fields[1].At(0))
@@ -574,7 +583,11 @@ func TestDatasourceStreamQueryRequest(t *testing.T) {
 		b, _ := labelsToJSON(labels)
 
 		labelsField.Append(b)
-		frame := data.NewFrame("", timeFd, lineField, labelsField)
+
+		levelFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+		levelFd.Name = gDetectedLevelField
+		levelFd.Append(logLevelUnknown)
+		frame := data.NewFrame("", timeFd, lineField, labelsField, levelFd)
 		frame.Meta = &data.FrameMeta{PreferredVisualization: logsVisualisation}
 
 		return frame
@@ -626,7 +639,11 @@ func TestDatasourceStreamQueryRequest(t *testing.T) {
 		b, _ := labelsToJSON(labels)
 
 		labelsField.Append(b)
-		frame := data.NewFrame("", timeFd, lineField, labelsField)
+
+		levelFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+		levelFd.Name = gDetectedLevelField
+		levelFd.Append(logLevelUnknown)
+		frame := data.NewFrame("", timeFd, lineField, labelsField, levelFd)
 		frame.Meta = &data.FrameMeta{PreferredVisualization: logsVisualisation}
 		return frame
 	}
@@ -779,7 +796,11 @@ func TestDatasourceStreamRequestWithRetry(t *testing.T) {
 		b, _ := labelsToJSON(labels)
 
 		labelsField.Append(b)
-		frame := data.NewFrame("", timeFd, lineField, labelsField)
+
+		levelFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+		levelFd.Name = gDetectedLevelField
+		levelFd.Append(logLevelUnknown)
+		frame := data.NewFrame("", timeFd, lineField, labelsField, levelFd)
 		frame.Meta = &data.FrameMeta{PreferredVisualization: logsVisualisation}
 
 		return frame
@@ -831,7 +852,11 @@ func TestDatasourceStreamRequestWithRetry(t *testing.T) {
 		b, _ := labelsToJSON(labels)
 
 		labelsField.Append(b)
-		frame := data.NewFrame("", timeFd, lineField, labelsField)
+
+		levelFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+		levelFd.Name = gDetectedLevelField
+		levelFd.Append(logLevelUnknown)
+		frame := data.NewFrame("", timeFd, lineField, labelsField, levelFd)
 		frame.Meta = &data.FrameMeta{PreferredVisualization: logsVisualisation}
 		return frame
 	}
@@ -978,3 +1003,53 @@ func TestDatasource_checkAlertingRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestDatasource_QueryDataInvalidQueries(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"_msg":"123","_time":"2024-02-20T14:04:27Z"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{URL: srv.URL, JSONData: []byte(`{}`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	rsp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			{RefID: "A", JSON: []byte(`{"expr":"*","queryType":"instant"}`)},
+			{RefID: "B", JSON: []byte(`{"expr":`)},
+			{RefID: "C", JSON: []byte(`{"expr":"","queryType":"stats"}`)},
+			{RefID: "D", JSON: []byte(`{"expr":"*","queryType":"hits","field":"level","step":"-1m"}`)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("invalid queries must not fail the whole request: %s", err)
+	}
+	if len(rsp.Responses) != 4 {
+		t.Fatalf("expected 4 responses; got %d", len(rsp.Responses))
+	}
+	if r := rsp.Responses["A"]; r.Error != nil || len(r.Frames) != 1 {
+		t.Fatalf("expected valid query to succeed; got error %v and %d frames", r.Error, len(r.Frames))
+	}
+
+	f := func(refID, wantErr string) {
+		t.Helper()
+		r := rsp.Responses[refID]
+		if r.Error == nil || !strings.Contains(r.Error.Error(), wantErr) {
+			t.Fatalf("expected error %q for query %s; got %v", wantErr, refID, r.Error)
+		}
+		if r.Status != backend.StatusBadRequest {
+			t.Fatalf("expected status %d for query %s; got %d", backend.StatusBadRequest, refID, r.Status)
+		}
+		if r.ErrorSource != backend.ErrorSourceDownstream {
+			t.Fatalf("expected downstream error source for query %s; got %q", refID, r.ErrorSource)
+		}
+	}
+	f("B", `invalid query "B": failed to parse query json`)
+	f("C", `invalid query "C": expr can't be empty for stats query`)
+	f("D", `invalid query "D": step must be positive`)
+}
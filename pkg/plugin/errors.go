@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	// maxErrorResponseSize is the max size of the error response body
+	// read from the datasource
+	maxErrorResponseSize = 64 * 1024
+	// statusClientClosedRequest is returned when the query is canceled by the client,
+	// e.g. when the user navigates away from the dashboard. It follows the nginx convention,
+	// since backend.Status doesn't define such status.
+	statusClientClosedRequest backend.Status = 499
+)
+
+// responseStatusError is returned when the datasource responds
+// with unexpected status code
+type responseStatusError struct {
+	statusCode int
+	// body contains the error message received from the datasource
+	body string
+	err  error
+}
+
+// newResponseStatusError returns a new responseStatusError for the status code
+// and the error message received from the datasource
+func newResponseStatusError(statusCode int, msg string) *responseStatusError {
+	err := fmt.Errorf("got unexpected response status code: %d", statusCode)
+	if msg != "" {
+		err = fmt.Errorf("%w: %s", err, msg)
+	}
+	return &responseStatusError{statusCode: statusCode, body: msg, err: err}
+}
+
+func (e *responseStatusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *responseStatusError) Unwrap() error {
+	return e.err
+}
+
+// classifyError returns the status of the response and the source of the error
+// which occurred during the request to the datasource
+func classifyError(err error) (backend.Status, backend.ErrorSource) {
+	var se *responseStatusError
+	if errors.As(err, &se) {
+		return statusFromResponseCode(se.statusCode), backend.ErrorSourceDownstream
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errQueueTimeout):
+		// the request is rejected by the plugin itself
+		return backend.StatusTooManyRequests, backend.ErrorSourcePlugin
+	case errors.Is(err, context.Canceled):
+		// the query is canceled by the client, so it isn't the plugin failure
+		return statusClientClosedRequest, backend.ErrorSourceDownstream
+	case errors.Is(err, errCircuitOpen):
+		return backend.StatusBadGateway, backend.ErrorSourceDownstream
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return backend.StatusTimeout, backend.ErrorSourceDownstream
+	case backend.IsDownstreamHTTPError(err), isTrivialError(err):
+		return backend.StatusBadGateway, backend.ErrorSourceDownstream
+	default:
+		return backend.StatusInternal, backend.ErrorSourcePlugin
+	}
+}
+
+// statusFromResponseCode maps the status code of the datasource response to backend.Status
+func statusFromResponseCode(code int) backend.Status {
+	switch {
+	case code == http.StatusBadRequest, code == http.StatusUnprocessableEntity:
+		return backend.StatusBadRequest
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return backend.StatusUnauthorized
+	case code == http.StatusNotFound:
+		return backend.StatusNotFound
+	case code == http.StatusTooManyRequests:
+		return backend.StatusTooManyRequests
+	case code >= http.StatusInternalServerError:
+		return backend.StatusBadGateway
+	default:
+		return backend.StatusInternal
+	}
+}
+
+// newRequestErrorResponse returns a new backend.DataResponse for the error
+// which occurred during the request to the datasource. The status and the source
+// of the error are defined by classifyError.
+func newRequestErrorResponse(err error) backend.DataResponse {
+	status, source := classifyError(err)
+	log.DefaultLogger.Error("request to the datasource failed", "err", err.Error(), "status", int(status), "errorSource", source)
+	return backend.DataResponse{Status: status, Error: err, ErrorSource: source}
+}
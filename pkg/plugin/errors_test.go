@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func Test_classifyError(t *testing.T) {
+	f := func(err error, wantStatus backend.Status, wantSource backend.ErrorSource) {
+		t.Helper()
+		status, source := classifyError(err)
+		if status != wantStatus {
+			t.Fatalf("expected status %d; got %d", wantStatus, status)
+		}
+		if source != wantSource {
+			t.Fatalf("expected source %q; got %q", wantSource, source)
+		}
+	}
+
+	f(newResponseStatusError(http.StatusBadRequest, "cannot parse query"), backend.StatusBadRequest, backend.ErrorSourceDownstream)
+	f(newResponseStatusError(http.StatusUnprocessableEntity, ""), backend.StatusBadRequest, backend.ErrorSourceDownstream)
+	f(newResponseStatusError(http.StatusUnauthorized, ""), backend.StatusUnauthorized, backend.ErrorSourceDownstream)
+	f(newResponseStatusError(http.StatusForbidden, ""), backend.StatusUnauthorized, backend.ErrorSourceDownstream)
+	f(newResponseStatusError(http.StatusTooManyRequests, ""), backend.StatusTooManyRequests, backend.ErrorSourceDownstream)
+	f(newResponseStatusError(http.StatusInternalServerError, ""), backend.StatusBadGateway, backend.ErrorSourceDownstream)
+	f(newResponseStatusError(http.StatusServiceUnavailable, ""), backend.StatusBadGateway, backend.ErrorSourceDownstream)
+	f(fmt.Errorf("failed to make http request: %w", context.DeadlineExceeded), backend.StatusTimeout, backend.ErrorSourceDownstream)
+	f(fmt.Errorf("failed to make http request: %w", context.Canceled), statusClientClosedRequest, backend.ErrorSourceDownstream)
+	f(fmt.Errorf("%w: max 2 concurrent requests", errQueueTimeout), backend.StatusTooManyRequests, backend.ErrorSourcePlugin)
+	f(fmt.Errorf("%w after too many failed requests", errCircuitOpen), backend.StatusBadGateway, backend.ErrorSourceDownstream)
+	f(fmt.Errorf("failed to make http request: %w", errors.New("connection reset by peer")), backend.StatusBadGateway, backend.ErrorSourceDownstream)
+	f(errors.New("failed to create request URL"), backend.StatusInternal, backend.ErrorSourcePlugin)
+}
+
+func TestDatasource_queryErrors(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		status int
+		body   string
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		status, body := status, body
+		mu.Unlock()
+		if status == 0 {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL:      srv.URL,
+		JSONData: []byte(`{"retryPolicy":{"maxAttempts":1}}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	f := func(code int, respBody string, wantStatus backend.Status, wantErr string) {
+		t.Helper()
+		mu.Lock()
+		status, body = code, respBody
+		mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		rsp := ds.query(ctx, &Query{
+			DataQuery: backend.DataQuery{RefID: "A"},
+			Expr:      "*",
+			QueryType: QueryTypeInstant,
+		})
+		if rsp.Error == nil || !strings.Contains(rsp.Error.Error(), wantErr) {
+			t.Fatalf("expected error %q; got %v", wantErr, rsp.Error)
+		}
+		if rsp.Status != wantStatus {
+			t.Fatalf("expected status %d; got %d", wantStatus, rsp.Status)
+		}
+		if rsp.ErrorSource != backend.ErrorSourceDownstream {
+			t.Fatalf("expected source %q; got %q", backend.ErrorSourceDownstream, rsp.ErrorSource)
+		}
+	}
+
+	f(http.StatusBadRequest, "cannot parse query [foo:]: missing value", backend.StatusBadRequest,
+		"got unexpected response status code: 400: cannot parse query [foo:]: missing value")
+	f(http.StatusUnprocessableEntity, `{"status":"error","error":"unknown pipe"}`, backend.StatusBadRequest,
+		"got unexpected response status code: 422: unknown pipe")
+	f(http.StatusUnauthorized, "", backend.StatusUnauthorized, "got unexpected response status code: 401")
+	f(http.StatusTooManyRequests, "slow down", backend.StatusTooManyRequests, "got unexpected response status code: 429: slow down")
+	f(http.StatusBadGateway, "upstream is down", backend.StatusBadGateway, "got unexpected response status code: 502: upstream is down")
+	// the server doesn't respond until the context deadline
+	f(0, "", backend.StatusTimeout, "context deadline exceeded")
+}
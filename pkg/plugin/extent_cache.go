@@ -0,0 +1,243 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/VictoriaMetrics/victorialogs-datasource/pkg/utils"
+)
+
+const defaultExtentCacheFreshness = 10 * time.Minute
+
+var (
+	extentCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "extent_cache_hits_total",
+		Help:      "The number of range queries which buckets were partially served from the extent cache",
+	}, []string{"datasource_uid"})
+	extentCacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "extent_cache_misses_total",
+		Help:      "The number of range queries which buckets were not found in the extent cache",
+	}, []string{"datasource_uid"})
+)
+
+// extent contains the frames of the range query with buckets
+// which timestamps are in [start, end] range. All buckets of
+// the extent are closed, so they can't be changed by new logs.
+type extent struct {
+	start  time.Time
+	end    time.Time
+	frames data.Frames
+}
+
+// newExtentCache returns a new lruCache for extents of range queries
+func newExtentCache(datasourceUID string, maxSize int) *lruCache {
+	return newLRUCache(maxSize, 0, extentCacheHits.WithLabelValues(datasourceUID), extentCacheMisses.WithLabelValues(datasourceUID))
+}
+
+// isExtentCacheable checks if buckets of the query can be cached in the extent cache.
+// Alerting requests are always sent to the datasource.
+func (q *Query) isExtentCacheable() bool {
+	if q.ForAlerting {
+		return false
+	}
+	return q.QueryType == QueryTypeStatsRange || q.QueryType == QueryTypeHits
+}
+
+// extentQuery returns the buckets of the range query from the extent cache
+// and requests only missing head and tail of the time range from the datasource.
+// Closed buckets of the response are stored in the cache for the next requests.
+func (d *Datasource) extentQuery(ctx context.Context, q *Query) backend.DataResponse {
+	q.alignToStep = true
+	reqURL, err := q.getQueryURL(d.settings.URL, d.grafanaSettings.QueryParams)
+	if err != nil {
+		return newResponseError(fmt.Errorf("failed to create request URL: %w", err), backend.StatusInternal)
+	}
+	headers := d.queryHeaders(q)
+	key, step, err := extentCacheKey(reqURL, headers, q.forwardedHeaders, q.identity.cacheKey())
+	if err != nil {
+		return newResponseError(err, backend.StatusInternal)
+	}
+
+	tr := q.TimeRange
+	var cached *extent
+	if v, ok := d.extentCache.get(key); ok {
+		cached = v.(*extent)
+		if cached.end.Before(tr.From) || cached.start.After(tr.To) {
+			// cached extent doesn't overlap with the requested time range
+			cached = nil
+		}
+	}
+
+	var ranges []backend.TimeRange
+	if cached == nil {
+		ranges = append(ranges, tr)
+	} else {
+		if tr.From.Before(cached.start) {
+			ranges = append(ranges, backend.TimeRange{From: tr.From, To: cached.start.Add(-time.Nanosecond)})
+		}
+		if tailStart := cached.end.Add(step); !tr.To.Before(tailStart) {
+			ranges = append(ranges, backend.TimeRange{From: tailStart, To: tr.To})
+		}
+	}
+
+	frameSets := make([]data.Frames, 0, len(ranges)+1)
+	if cached != nil {
+		frameSets = append(frameSets, cached.frames)
+	}
+	for _, r := range ranges {
+		rsp := d.rangeQuery(ctx, reqURL, r, q)
+		if rsp.Error != nil {
+			return rsp
+		}
+		frameSets = append(frameSets, rsp.Frames)
+	}
+
+	frames, err := stitchFrames(tr.From, tr.To, frameSets...)
+	if err != nil {
+		return newResponseError(err, backend.StatusInternal)
+	}
+
+	// the bucket is closed if its end is before the freshness window
+	lastClosed := time.Now().Add(-d.grafanaSettings.extentCacheFreshness).Truncate(step).Add(-step)
+	// the stored extent is limited by the requested time range, so it doesn't
+	// grow infinitely for the dashboard with the moving time range
+	start, end := tr.From, tr.To
+	if end.After(lastClosed) {
+		end = lastClosed
+	}
+	if !end.Before(start) {
+		closed, err := stitchFrames(start, end, frameSets...)
+		if err != nil {
+			return newResponseError(err, backend.StatusInternal)
+		}
+		d.extentCache.set(key, &extent{start: start, end: end, frames: closed})
+	}
+
+	return backend.DataResponse{Frames: frames}
+}
+
+// rangeQuery sends the range query to the datasource for the given time range
+func (d *Datasource) rangeQuery(ctx context.Context, reqURL string, tr backend.TimeRange, q *Query) backend.DataResponse {
+	reqURL, err := setTimeRangeParams(reqURL, tr)
+	if err != nil {
+		return newResponseError(err, backend.StatusInternal)
+	}
+
+	r, err := d.sendRequest(ctx, reqURL, d.queryHeaders(q), q.ForAlerting)
+	if err != nil {
+		return newRequestErrorResponse(err)
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			log.DefaultLogger.Error("failed to close response body", "err", err.Error())
+		}
+	}()
+
+	return d.parseResponse(ctx, r, q)
+}
+
+// extentCacheKey returns the key of the range query without its time range
+// and the step of the query
+func extentCacheKey(reqURL string, headers, forwardedHeaders http.Header, identity string) (string, time.Duration, error) {
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to parse request url: %w", err)
+	}
+	values := u.Query()
+	step, err := utils.ParseDuration(values.Get("step"))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to parse step %q: %w", values.Get("step"), err)
+	}
+	if step <= 0 {
+		return "", 0, fmt.Errorf("step must be positive; got %q", values.Get("step"))
+	}
+	values.Del("start")
+	values.Del("end")
+	u.RawQuery = values.Encode()
+	return cacheKey(u.String(), headers, forwardedHeaders, identity), step, nil
+}
+
+// stitchFrames merges time series frames of the same query into one frame per series.
+// Series are identified by frame name and labels of the value field. Points with
+// the same timestamp are taken from the latest frames. Only points in [from, to]
+// range are returned.
+func stitchFrames(from, to time.Time, frameSets ...data.Frames) (data.Frames, error) {
+	type point struct {
+		ts    time.Time
+		value float64
+	}
+	type series struct {
+		template *data.Frame
+		points   map[int64]point
+	}
+	var keys []string
+	seriesByKey := make(map[string]*series)
+	for _, frames := range frameSets {
+		for _, frame := range frames {
+			if len(frame.Fields) != 2 {
+				return nil, fmt.Errorf("failed to stitch frames: expected 2 fields in the frame; got %d", len(frame.Fields))
+			}
+			timeFd, valueFd := frame.Fields[0], frame.Fields[1]
+			if timeFd.Type() != data.FieldTypeTime || valueFd.Type() != data.FieldTypeFloat64 {
+				return nil, fmt.Errorf("failed to stitch frames: unexpected field types %s and %s", timeFd.Type(), valueFd.Type())
+			}
+
+			key := frame.Name + valueFd.Labels.String()
+			s, ok := seriesByKey[key]
+			if !ok {
+				s = &series{template: frame, points: make(map[int64]point)}
+				seriesByKey[key] = s
+				keys = append(keys, key)
+			}
+			for i := 0; i < frame.Rows(); i++ {
+				ts := timeFd.At(i).(time.Time)
+				if ts.Before(from) || ts.After(to) {
+					continue
+				}
+				s.points[ts.UnixNano()] = point{ts: ts, value: valueFd.At(i).(float64)}
+			}
+		}
+	}
+
+	frames := make(data.Frames, 0, len(keys))
+	for _, key := range keys {
+		s := seriesByKey[key]
+		if len(s.points) == 0 {
+			continue
+		}
+		points := make([]point, 0, len(s.points))
+		for _, p := range s.points {
+			points = append(points, p)
+		}
+		sort.Slice(points, func(i, j int) bool {
+			return points[i].ts.Before(points[j].ts)
+		})
+		timestamps := make([]time.Time, len(points))
+		values := make([]float64, len(points))
+		for i, p := range points {
+			timestamps[i] = p.ts
+			values[i] = p.value
+		}
+
+		tpl := s.template
+		timeFd := data.NewField(tpl.Fields[0].Name, tpl.Fields[0].Labels, timestamps)
+		valueFd := data.NewField(tpl.Fields[1].Name, tpl.Fields[1].Labels, values)
+		valueFd.Config = tpl.Fields[1].Config
+		frame := data.NewFrame(tpl.Name, timeFd, valueFd)
+		frame.Meta = tpl.Meta
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
@@ -0,0 +1,181 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func Test_stitchFrames(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newFrame := func(labels data.Labels, points map[int]float64) *data.Frame {
+		var timestamps []time.Time
+		var values []float64
+		for i := 0; i < 10; i++ {
+			if v, ok := points[i]; ok {
+				timestamps = append(timestamps, ts.Add(time.Duration(i)*time.Minute))
+				values = append(values, v)
+			}
+		}
+		return data.NewFrame("",
+			data.NewField(data.TimeSeriesTimeFieldName, nil, timestamps),
+			data.NewField(data.TimeSeriesValueFieldName, labels, values))
+	}
+
+	cached := data.Frames{
+		newFrame(data.Labels{"level": "info"}, map[int]float64{0: 1, 1: 2, 2: 3}),
+		newFrame(data.Labels{"level": "error"}, map[int]float64{1: 10}),
+	}
+	fresh := data.Frames{
+		newFrame(data.Labels{"level": "info"}, map[int]float64{2: 30, 3: 4}),
+		newFrame(data.Labels{"level": "warn"}, map[int]float64{3: 5}),
+	}
+
+	got, err := stitchFrames(ts.Add(time.Minute), ts.Add(3*time.Minute), cached, fresh)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := data.Frames{
+		newFrame(data.Labels{"level": "info"}, map[int]float64{1: 2, 2: 30, 3: 4}),
+		newFrame(data.Labels{"level": "error"}, map[int]float64{1: 10}),
+		newFrame(data.Labels{"level": "warn"}, map[int]float64{3: 5}),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d frames; got %d", len(want), len(got))
+	}
+	for i := range want {
+		wantJSON, _ := data.FrameToJSON(want[i], data.IncludeAll)
+		gotJSON, _ := data.FrameToJSON(got[i], data.IncludeAll)
+		if string(wantJSON) != string(gotJSON) {
+			t.Fatalf("frame #%d: expected\n%s\ngot\n%s", i, wantJSON, gotJSON)
+		}
+	}
+
+	if _, err := stitchFrames(ts, ts, data.Frames{data.NewFrame("", data.NewField("a", nil, []string{"b"}))}); err == nil {
+		t.Fatalf("expected error for frame with unexpected fields")
+	}
+}
+
+func Test_extentCacheKey(t *testing.T) {
+	k1, step, err := extentCacheKey("http://localhost/select/logsql/hits?query=*&start=1&end=2&step=1m", http.Header{}, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if step != time.Minute {
+		t.Fatalf("expected step 1m; got %s", step)
+	}
+	k2, _, _ := extentCacheKey("http://localhost/select/logsql/hits?query=*&start=5&end=6&step=1m", http.Header{}, nil, "")
+	if k1 != k2 {
+		t.Fatalf("expected the same keys for different time ranges; got %q and %q", k1, k2)
+	}
+	if _, _, err := extentCacheKey("http://localhost/select/logsql/hits?query=*&step=$__interval", http.Header{}, nil, ""); err == nil {
+		t.Fatalf("expected error for invalid step")
+	}
+}
+
+func TestDatasource_extentQuery(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/stats_query_range", func(w http.ResponseWriter, r *http.Request) {
+		start, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("start"))
+		if err != nil {
+			t.Errorf("unexpected start param: %s", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		end, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("end"))
+		if err != nil {
+			t.Errorf("unexpected end param: %s", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requested = append(requested, fmt.Sprintf("%s-%s", start.Format("15:04"), end.Format("15:04")))
+		mu.Unlock()
+
+		var values []string
+		for ts := start.Truncate(10 * time.Minute); !ts.After(end); ts = ts.Add(10 * time.Minute) {
+			if ts.Before(start) {
+				continue
+			}
+			values = append(values, fmt.Sprintf(`[%d,"%d"]`, ts.Unix(), ts.Minute()))
+		}
+		_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"level":"info"},"values":[%s]}]}}`, strings.Join(values, ","))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		UID:      "test-extent-query",
+		URL:      srv.URL,
+		JSONData: []byte(`{"extentCacheSize":10,"extentCacheFreshness":"5m"}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+	defer ds.Dispose()
+
+	ts := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+	f := func(from, to time.Time, wantRequests []string, wantPoints int) {
+		t.Helper()
+		mu.Lock()
+		requested = requested[:0]
+		mu.Unlock()
+
+		q := &Query{
+			DataQuery: backend.DataQuery{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: from, To: to},
+			},
+			Expr:      "* | stats by (level) count()",
+			Step:      "10m",
+			QueryType: QueryTypeStatsRange,
+		}
+		rsp := ds.query(context.Background(), q)
+		if rsp.Error != nil {
+			t.Fatalf("unexpected error: %s", rsp.Error)
+		}
+		mu.Lock()
+		got := strings.Join(requested, ",")
+		mu.Unlock()
+		if got != strings.Join(wantRequests, ",") {
+			t.Fatalf("expected requests %v; got %s", wantRequests, got)
+		}
+		if len(rsp.Frames) != 1 {
+			t.Fatalf("expected 1 frame; got %d", len(rsp.Frames))
+		}
+		if rsp.Frames[0].Rows() != wantPoints {
+			t.Fatalf("expected %d points; got %d", wantPoints, rsp.Frames[0].Rows())
+		}
+		timeFd := rsp.Frames[0].Fields[0]
+		if first := timeFd.At(0).(time.Time); !first.Equal(q.TimeRange.From) {
+			t.Fatalf("expected the first point at %s; got %s", q.TimeRange.From, first)
+		}
+	}
+
+	// the whole time range is requested
+	f(ts, ts.Add(time.Hour), []string{"01:00-02:00"}, 7)
+	// only the tail is requested
+	f(ts.Add(20*time.Minute), ts.Add(80*time.Minute), []string{"02:10-02:20"}, 7)
+	// only the head is requested, the cached extent was trimmed to the previous time range
+	f(ts.Add(-20*time.Minute), ts.Add(80*time.Minute), []string{"00:40-01:19"}, 11)
+	// the whole time range is cached
+	f(ts.Add(-10*time.Minute), ts.Add(70*time.Minute), nil, 9)
+	// the cached extent doesn't grow beyond the last requested time range
+	f(ts.Add(-20*time.Minute), ts.Add(70*time.Minute), []string{"00:40-00:49"}, 10)
+	// buckets which are not closed yet are always requested
+	now := time.Now().UTC().Truncate(10 * time.Minute)
+	f(now.Add(-time.Hour), now, []string{now.Add(-time.Hour).Format("15:04") + "-" + now.Format("15:04")}, 7)
+	tailStart := time.Now().UTC().Add(-5 * time.Minute).Truncate(10 * time.Minute)
+	f(now.Add(-time.Hour), now, []string{tailStart.Format("15:04") + "-" + now.Format("15:04")}, 7)
+}
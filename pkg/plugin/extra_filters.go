@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+const (
+	extraFiltersParam       = "extra_filters"
+	extraStreamFiltersParam = "extra_stream_filters"
+)
+
+// extraFiltersVarRegexp matches variables of extra filters templates, e.g. ${__user.login}
+var extraFiltersVarRegexp = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// extraFiltersVars contains variables which can be used in extra filters templates
+var extraFiltersVars = []string{"__user.login", "__user.email", "__user.name", "__user.role", "__org.id", "__team"}
+
+// extraFiltersVarValues returns values of extra filters variables for the Grafana user.
+// team is the name of the tenant mapping rule matching the user.
+func extraFiltersVarValues(pCtx backend.PluginContext, team string) map[string]string {
+	values := map[string]string{
+		"__team": team,
+	}
+	if pCtx.OrgID > 0 {
+		values["__org.id"] = strconv.FormatInt(pCtx.OrgID, 10)
+	}
+	if u := pCtx.User; u != nil {
+		values["__user.login"] = u.Login
+		values["__user.email"] = u.Email
+		values["__user.name"] = u.Name
+		values["__user.role"] = u.Role
+	}
+	return values
+}
+
+// extraFilters contains extra_filters and extra_stream_filters args
+// rendered for the Grafana user. The user can't override them in the query.
+// They are applied only to requests sent by the backend, not via the Grafana data source proxy.
+// See https://docs.victoriametrics.com/victorialogs/querying/#extra-filters
+type extraFilters struct {
+	filters       string
+	streamFilters string
+}
+
+// setParams sets extra filters to the query args of the request,
+// so they override the args set in custom query params or in the request
+func (ef extraFilters) setParams(params url.Values) {
+	if ef.filters != "" {
+		params.Set(extraFiltersParam, ef.filters)
+	}
+	if ef.streamFilters != "" {
+		params.Set(extraStreamFiltersParam, ef.streamFilters)
+	}
+}
+
+// validateExtraFiltersTemplate checks that the template uses only known variables
+func validateExtraFiltersTemplate(tpl string) error {
+	for _, m := range extraFiltersVarRegexp.FindAllStringSubmatch(tpl, -1) {
+		if !slices.Contains(extraFiltersVars, m[1]) {
+			return fmt.Errorf("unknown variable %q; supported variables: %s", m[0], strings.Join(extraFiltersVars, ", "))
+		}
+	}
+	return nil
+}
+
+// renderExtraFiltersTemplate replaces variables of the template with values of the Grafana user.
+// Values are escaped, so they can be used in quoted strings of LogsQL filters.
+// It returns error if the value of the variable is empty, since the filter
+// with empty value could match logs of other users.
+func renderExtraFiltersTemplate(tpl string, values map[string]string) (string, error) {
+	var err error
+	s := extraFiltersVarRegexp.ReplaceAllStringFunc(tpl, func(v string) string {
+		value := values[v[2:len(v)-1]]
+		if value == "" && err == nil {
+			err = fmt.Errorf("variable %q has no value for the request", v)
+		}
+		return quoteEscape(value)
+	})
+	if err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// quoteEscape escapes the value for double-quoted strings of LogsQL
+func quoteEscape(s string) string {
+	q := strconv.Quote(s)
+	return q[1 : len(q)-1]
+}
+
+// extraFilters returns extra filters for the Grafana user from the plugin context
+func (gs *GrafanaSettings) extraFilters(pCtx backend.PluginContext) (extraFilters, error) {
+	var ef extraFilters
+	if gs.ExtraFilters == "" && gs.ExtraStreamFilters == "" {
+		return ef, nil
+	}
+
+	var team string
+	if r := gs.matchTenantRule(pCtx); r != nil {
+		team = r.Name
+	}
+	values := extraFiltersVarValues(pCtx, team)
+	var err error
+	ef.filters, err = renderExtraFiltersTemplate(strings.TrimSpace(gs.ExtraFilters), values)
+	if err != nil {
+		return ef, fmt.Errorf("%w: cannot render extra filters: %w", errAccessForbidden, err)
+	}
+	ef.streamFilters, err = renderExtraFiltersTemplate(strings.TrimSpace(gs.ExtraStreamFilters), values)
+	if err != nil {
+		return ef, fmt.Errorf("%w: cannot render extra stream filters: %w", errAccessForbidden, err)
+	}
+	return ef, nil
+}
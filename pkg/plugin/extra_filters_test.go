@@ -0,0 +1,145 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestRenderExtraFiltersTemplate(t *testing.T) {
+	pCtx := backend.PluginContext{
+		OrgID: 3,
+		User:  &backend.User{Login: "alice", Email: "alice@example.com", Name: `Alice "A"`, Role: "Viewer"},
+	}
+	values := extraFiltersVarValues(pCtx, "team-a")
+
+	f := func(tpl, want string) {
+		t.Helper()
+		if err := validateExtraFiltersTemplate(tpl); err != nil {
+			t.Fatalf("unexpected validation error: %s", err)
+		}
+		got, err := renderExtraFiltersTemplate(tpl, values)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != want {
+			t.Fatalf("unexpected result for %q; got %q; want %q", tpl, got, want)
+		}
+	}
+	f("", "")
+	f(`{namespace="team-a"}`, `{namespace="team-a"}`)
+	f(`{namespace="${__team}"}`, `{namespace="team-a"}`)
+	f(`user:="${__user.login}" OR email:="${__user.email}"`, `user:="alice" OR email:="alice@example.com"`)
+	f(`org:=${__org.id} role:=${__user.role}`, `org:=3 role:=Viewer`)
+	// values are escaped, so they can't break out of quoted strings
+	f(`name:="${__user.name}"`, `name:="Alice \"A\""`)
+
+	if err := validateExtraFiltersTemplate(`user:="${__user.id}"`); err == nil {
+		t.Fatalf("expected error for unknown variable")
+	}
+
+	// empty values must not produce filters matching logs of other users
+	if _, err := renderExtraFiltersTemplate(`user:="${__user.login}"`, extraFiltersVarValues(backend.PluginContext{OrgID: 1}, "")); err == nil {
+		t.Fatalf("expected error for empty variable value")
+	}
+}
+
+func TestDatasource_extraFilters(t *testing.T) {
+	var mu sync.Mutex
+	got := make(map[string][2]string)
+	record := func(r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse form: %s", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		got[r.URL.Path] = [2]string{r.Form.Get("extra_filters"), r.Form.Get("extra_stream_filters")}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		_, _ = w.Write([]byte(`{"_msg":"foo","_time":"2024-02-20T14:04:27Z"}`))
+	})
+	mux.HandleFunc("/select/logsql/field_names", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		_, _ = w.Write([]byte(`{"values":[]}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL: srv.URL,
+		JSONData: []byte(`{"httpMethod":"POST","customQueryParameters":"extra_filters=*",` +
+			`"extraFilters":"user:=\"${__user.login}\"","extraStreamFilters":"{namespace=\"${__team}\"}",` +
+			`"tenantMapping":[{"name":"team-a","users":["alice"],"tenant":"0:0"},{"name":"org-1","orgId":1,"tenant":"1:0"}]}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	now := time.Now()
+	query := func(user *backend.User) backend.DataResponse {
+		t.Helper()
+		rsp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+			PluginContext: backend.PluginContext{OrgID: 1, User: user},
+			Queries: []backend.DataQuery{
+				{RefID: "A", TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now}, JSON: []byte(`{"expr":"*","queryType":"instant"}`)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return rsp.Responses["A"]
+	}
+
+	alice := &backend.User{Login: "alice", Role: "Viewer"}
+	if r := query(alice); r.Error != nil {
+		t.Fatalf("unexpected error: %s", r.Error)
+	}
+
+	var status int
+	sender := backend.CallResourceResponseSenderFunc(func(resp *backend.CallResourceResponse) error {
+		status = resp.Status
+		return nil
+	})
+	resource := func(user *backend.User) int {
+		t.Helper()
+		status = 0
+		err := ds.CallResource(context.Background(), &backend.CallResourceRequest{
+			PluginContext: backend.PluginContext{OrgID: 1, User: user},
+			Path:          "select/logsql/field_names",
+			URL:           `select/logsql/field_names?query=*&extra_filters=user:="bob"`,
+		}, sender)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return status
+	}
+	if s := resource(alice); s != http.StatusOK {
+		t.Fatalf("unexpected status of resource response %d; want %d", s, http.StatusOK)
+	}
+
+	mu.Lock()
+	want := [2]string{`user:="alice"`, `{namespace="team-a"}`}
+	for _, path := range []string{"/select/logsql/query", "/select/logsql/field_names"} {
+		if got[path] != want {
+			t.Fatalf("unexpected extra filters of %s request; got %q; want %q", path, got[path], want)
+		}
+	}
+	mu.Unlock()
+
+	// alerting queries have no user, so the filters with user variables can't be rendered
+	if r := query(nil); !errors.Is(r.Error, errAccessForbidden) {
+		t.Fatalf("expected forbidden error for the request without user; got %v", r.Error)
+	}
+	if s := resource(nil); s != http.StatusForbidden {
+		t.Fatalf("unexpected status of resource response %d; want %d", s, http.StatusForbidden)
+	}
+}
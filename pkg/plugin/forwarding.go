@@ -0,0 +1,181 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	// headerForwardingAll forwards all headers of the Grafana request
+	headerForwardingAll = "all"
+	// headerForwardingAllowlist forwards only headers matching the allowlist
+	headerForwardingAllowlist = "allowlist"
+	// headerForwardingOAuth forwards only OAuth identity tokens of the user
+	headerForwardingOAuth = "oauth"
+	// headerForwardingNone doesn't forward headers of the Grafana request
+	headerForwardingNone = "none"
+
+	redactedHeaderValue = "<redacted>"
+)
+
+// oauthHeaders contains headers with OAuth identity tokens forwarded by Grafana
+var oauthHeaders = []string{backend.OAuthIdentityTokenHeaderName, backend.OAuthIdentityIDTokenHeaderName}
+
+// HeaderForwardingSettings defines which headers of the Grafana request
+// are forwarded to the datasource
+type HeaderForwardingSettings struct {
+	// Mode defines the forwarding mode: all, allowlist, oauth or none.
+	// All headers are forwarded by default, unless the signed identity is enabled.
+	Mode string `json:"mode"`
+	// Allowlist contains names or regular expressions of headers forwarded in allowlist mode
+	Allowlist []string `json:"allowlist"`
+	// Denylist contains names or regular expressions of headers which are never forwarded
+	Denylist []string `json:"denylist"`
+}
+
+// headerFilter filters headers of the Grafana request forwarded to the datasource
+type headerFilter struct {
+	mode  string
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// parse returns the filter of forwarded headers.
+// defaultMode is used if the mode isn't set.
+func (s HeaderForwardingSettings) parse(defaultMode string) (*headerFilter, error) {
+	hf := &headerFilter{mode: s.Mode}
+	if hf.mode == "" {
+		hf.mode = defaultMode
+	}
+	switch hf.mode {
+	case headerForwardingAll, headerForwardingOAuth, headerForwardingNone:
+	case headerForwardingAllowlist:
+		if len(s.Allowlist) == 0 {
+			return nil, fmt.Errorf("allowlist can't be empty in %s mode", headerForwardingAllowlist)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported mode %q; supported modes: %s, %s, %s, %s",
+			hf.mode, headerForwardingAll, headerForwardingAllowlist, headerForwardingOAuth, headerForwardingNone)
+	}
+
+	var err error
+	hf.allow, err = compileHeaderPatterns(s.Allowlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse allowlist: %w", err)
+	}
+	hf.deny, err = compileHeaderPatterns(s.Denylist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse denylist: %w", err)
+	}
+	return hf, nil
+}
+
+// compileHeaderPatterns compiles header patterns into case-insensitive regexps matching the whole header name
+func compileHeaderPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		re, err := regexp.Compile("(?i)^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse header pattern %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// filter returns headers of the Grafana request which can be forwarded to the datasource.
+// Tenant headers are never forwarded, since the tenant is defined by the datasource settings.
+func (hf *headerFilter) filter(headers http.Header) http.Header {
+	if hf == nil || hf.mode == headerForwardingNone || len(headers) == 0 {
+		return nil
+	}
+	var res http.Header
+	for name, values := range headers {
+		if isTenantHeader(name) || !hf.allowed(name) || matchesAny(hf.deny, name) {
+			continue
+		}
+		if res == nil {
+			res = http.Header{}
+		}
+		res[http.CanonicalHeaderKey(name)] = values
+	}
+	return res
+}
+
+// allowed checks if the header can be forwarded in the mode of the filter
+func (hf *headerFilter) allowed(name string) bool {
+	switch hf.mode {
+	case headerForwardingAll:
+		return true
+	case headerForwardingOAuth:
+		for _, h := range oauthHeaders {
+			if strings.EqualFold(name, h) {
+				return true
+			}
+		}
+		return false
+	case headerForwardingAllowlist:
+		return matchesAny(hf.allow, name)
+	default:
+		return false
+	}
+}
+
+func matchesAny(res []*regexp.Regexp, name string) bool {
+	for _, re := range res {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// addForwardedHeaders adds forwarded headers to the request headers.
+// Forwarded headers don't override the headers set by the datasource,
+// e.g. custom headers or the signed identity.
+func addForwardedHeaders(h, forwarded http.Header) {
+	for name, values := range forwarded {
+		if h.Get(name) != "" {
+			continue
+		}
+		for _, v := range values {
+			h.Add(name, v)
+		}
+	}
+}
+
+// isDebugEnabled returns true if debug logging is enabled
+func isDebugEnabled() bool {
+	level := log.DefaultLogger.Level()
+	return level == log.Debug || level == log.Trace
+}
+
+// redactHeaders returns headers of the request for logging.
+// Values of all headers except the tenant are redacted, since they can contain credentials.
+func redactHeaders(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := redactedHeaderValue
+		if isTenantHeader(name) {
+			value = strings.Join(h[name], ",")
+		}
+		parts = append(parts, name+": "+value)
+	}
+	return strings.Join(parts, "; ")
+}
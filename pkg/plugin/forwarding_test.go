@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestHeaderFilter_filter(t *testing.T) {
+	headers := http.Header{
+		"Authorization": {"Bearer token"},
+		"X-Id-Token":    {"id-token"},
+		"Cookie":        {"grafana_session=foo"},
+		"X-Team":        {"team-a"},
+		"X-Trace-Id":    {"123"},
+		"Accountid":     {"5"},
+	}
+	f := func(s HeaderForwardingSettings, defaultMode string, want ...string) {
+		t.Helper()
+		hf, err := s.parse(defaultMode)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var got []string
+		for name := range hf.filter(headers) {
+			got = append(got, name)
+		}
+		if !equalStringSets(got, want) {
+			t.Fatalf("unexpected forwarded headers for %+v; got %v; want %v", s, got, want)
+		}
+	}
+	// tenant headers are never forwarded
+	f(HeaderForwardingSettings{}, headerForwardingAll, "Authorization", "X-Id-Token", "Cookie", "X-Team", "X-Trace-Id")
+	f(HeaderForwardingSettings{}, headerForwardingNone)
+	f(HeaderForwardingSettings{Mode: "oauth"}, headerForwardingAll, "Authorization", "X-Id-Token")
+	f(HeaderForwardingSettings{Mode: "oauth", Denylist: []string{"x-id-token"}}, headerForwardingAll, "Authorization")
+	f(HeaderForwardingSettings{Mode: "allowlist", Allowlist: []string{"x-team", "X-Trace-.*", "AccountID"}}, headerForwardingAll, "X-Team", "X-Trace-Id")
+	// patterns match the whole header name
+	f(HeaderForwardingSettings{Mode: "allowlist", Allowlist: []string{"X-T"}}, headerForwardingAll)
+	f(HeaderForwardingSettings{Mode: "all", Denylist: []string{"cookie", "x-.*"}}, headerForwardingNone, "Authorization")
+
+	fErr := func(s HeaderForwardingSettings) {
+		t.Helper()
+		if _, err := s.parse(headerForwardingAll); err == nil {
+			t.Fatalf("expected error for %+v", s)
+		}
+	}
+	fErr(HeaderForwardingSettings{Mode: "foo"})
+	fErr(HeaderForwardingSettings{Mode: "allowlist"})
+	fErr(HeaderForwardingSettings{Mode: "allowlist", Allowlist: []string{"x-("}})
+	fErr(HeaderForwardingSettings{Denylist: []string{"["}})
+}
+
+func equalStringSets(a, b []string) bool {
+	m := make(map[string]int)
+	for _, s := range a {
+		m[s]++
+	}
+	for _, s := range b {
+		m[s]--
+	}
+	for _, n := range m {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRedactHeaders(t *testing.T) {
+	got := redactHeaders(http.Header{
+		"Authorization": {"Bearer secret"},
+		"Accountid":     {"1"},
+		"Cookie":        {"grafana_session=foo"},
+	})
+	want := "Accountid: 1; Authorization: <redacted>; Cookie: <redacted>"
+	if got != want {
+		t.Fatalf("unexpected result; got %q; want %q", got, want)
+	}
+}
+
+func TestDatasource_headerForwarding(t *testing.T) {
+	var mu sync.Mutex
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = r.Header.Clone()
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"_msg":"foo","_time":"2024-02-20T14:04:27Z"}`))
+	}))
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL:                     srv.URL,
+		JSONData:                []byte(`{"httpHeaderName1":"X-Scope","headerForwarding":{"mode":"allowlist","allowlist":["X-Scope","X-Team-.*","Authorization"],"denylist":["X-Team-Secret"]}}`),
+		DecryptedSecureJSONData: map[string]string{"httpHeaderValue1": "datasource"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	now := time.Now()
+	_, err = ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Headers: map[string]string{
+			"Authorization":        "Bearer user-token",
+			"Cookie":               "grafana_session=foo",
+			"http_X-Team-Name":     "team-a",
+			"http_X-Team-Secret":   "secret",
+			"http_X-Scope":         "user",
+			"http_X-Forwarded-For": "127.0.0.1",
+		},
+		Queries: []backend.DataQuery{
+			{RefID: "A", TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now}, JSON: []byte(`{"expr":"*","queryType":"instant"}`)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for name, want := range map[string][]string{
+		"Authorization":   {"Bearer user-token"},
+		"X-Team-Name":     {"team-a"},
+		"X-Scope":         {"datasource"}, // forwarded headers don't override custom headers
+		"Cookie":          nil,
+		"X-Team-Secret":   nil,
+		"X-Forwarded-For": nil,
+	} {
+		if !reflect.DeepEqual(got[name], want) {
+			t.Fatalf("unexpected value of %s header; got %q; want %q", name, got[name], want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package plugin
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+const (
+	// identityTokenKeyName is the name of the secure json data field
+	// which contains the key for signing identity tokens
+	identityTokenKeyName = "identityTokenKey"
+
+	identityAlgHS256 = "HS256"
+	identityAlgRS256 = "RS256"
+
+	defaultIdentityTokenTTL    = 5 * time.Minute
+	defaultIdentityTokenHeader = "Authorization"
+	// minHMACKeyLen is the min length of HS256 key recommended by RFC 7518
+	minHMACKeyLen = 32
+)
+
+// IdentityTokenSettings contains settings of the signed identity auth mode.
+// In this mode every request to the datasource contains short-lived JWT
+// with the identity of the Grafana user, so vmauth or a proxy in front of VictoriaLogs
+// can route requests and check access of the user without trusting forwarded headers.
+type IdentityTokenSettings struct {
+	// Enabled enables signed identity tokens
+	Enabled bool `json:"enabled"`
+	// Algorithm defines the signing algorithm: HS256 or RS256
+	Algorithm string `json:"algorithm"`
+	// Issuer is set to iss claim of the token
+	Issuer string `json:"issuer"`
+	// Audience is set to aud claim of the token
+	Audience string `json:"audience"`
+	// KeyID is set to kid header of the token, so the verifier can pick the key
+	KeyID string `json:"keyId"`
+	// TTL defines how long the token is valid
+	TTL string `json:"ttl"`
+	// Header defines the header of the request with the token.
+	// The token is sent as Bearer token if it is the Authorization header.
+	Header string `json:"header"`
+}
+
+// identitySigner signs identity tokens of Grafana users
+type identitySigner struct {
+	algorithm string
+	issuer    string
+	audience  string
+	keyID     string
+	ttl       time.Duration
+	header    string
+
+	hmacKey []byte
+	rsaKey  *rsa.PrivateKey
+}
+
+// parse returns the signer of identity tokens with the given key.
+// It returns nil if identity tokens are disabled.
+func (s IdentityTokenSettings) parse(key string) (*identitySigner, error) {
+	if !s.Enabled {
+		return nil, nil
+	}
+	is := &identitySigner{
+		algorithm: s.Algorithm,
+		issuer:    s.Issuer,
+		audience:  s.Audience,
+		keyID:     s.KeyID,
+		header:    http.CanonicalHeaderKey(strings.TrimSpace(s.Header)),
+	}
+	if is.algorithm == "" {
+		is.algorithm = identityAlgHS256
+	}
+	if is.header == "" {
+		is.header = defaultIdentityTokenHeader
+	}
+	if isTenantHeader(is.header) {
+		return nil, fmt.Errorf("header %q is reserved for the tenant", is.header)
+	}
+	var err error
+	is.ttl, err = parseDurationSetting("identity token ttl", s.TTL, defaultIdentityTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	if is.ttl <= 0 {
+		return nil, fmt.Errorf("identity token ttl must be positive; got %s", is.ttl)
+	}
+
+	if key == "" {
+		return nil, fmt.Errorf("signing key must be set in %q secure field", identityTokenKeyName)
+	}
+	switch is.algorithm {
+	case identityAlgHS256:
+		if len(key) < minHMACKeyLen {
+			return nil, fmt.Errorf("%s signing key must contain at least %d bytes", identityAlgHS256, minHMACKeyLen)
+		}
+		is.hmacKey = []byte(key)
+	case identityAlgRS256:
+		is.rsaKey, err = parseRSAPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q; supported algorithms: %s, %s", is.algorithm, identityAlgHS256, identityAlgRS256)
+	}
+	return is, nil
+}
+
+// parseRSAPrivateKey parses RSA private key in PEM format, both PKCS #1 and PKCS #8 are supported
+func parseRSAPrivateKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("cannot decode %s signing key: PEM block isn't found", identityAlgRS256)
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s signing key: %w", identityAlgRS256, err)
+	}
+	rk, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s signing key must be RSA private key; got %T", identityAlgRS256, k)
+	}
+	return rk, nil
+}
+
+// identityClaims contains claims of the identity token
+type identityClaims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf"`
+	ExpiresAt int64  `json:"exp"`
+
+	Login string `json:"login,omitempty"`
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+	OrgID int64  `json:"org_id"`
+	Role  string `json:"role,omitempty"`
+	// Team is the name of the tenant mapping rule matching the user
+	Team string `json:"team,omitempty"`
+}
+
+// userIdentity is the signed identity of the Grafana user,
+// which is sent in the header of requests to the datasource
+type userIdentity struct {
+	header string
+	value  string
+	// key identifies the user in cache keys, since the token is changed on every request
+	key string
+}
+
+// setHeader sets the identity token to the request headers
+func (id *userIdentity) setHeader(h http.Header) {
+	if id == nil {
+		return
+	}
+	h.Set(id.header, id.value)
+}
+
+// cacheKey returns the key of the identity for cache keys.
+// It returns empty string for nil identity.
+func (id *userIdentity) cacheKey() string {
+	if id == nil {
+		return ""
+	}
+	return id.key
+}
+
+// sign returns the identity of the Grafana user with the signed token
+func (is *identitySigner) sign(pCtx backend.PluginContext, team string, now time.Time) (*userIdentity, error) {
+	claims := identityClaims{
+		Issuer:    is.issuer,
+		Audience:  is.audience,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(is.ttl).Unix(),
+		OrgID:     pCtx.OrgID,
+		Team:      team,
+	}
+	if u := pCtx.User; u != nil {
+		claims.Subject = u.Login
+		claims.Login = u.Login
+		claims.Email = u.Email
+		claims.Name = u.Name
+		claims.Role = u.Role
+	}
+
+	token, err := is.signToken(claims)
+	if err != nil {
+		return nil, err
+	}
+	value := token
+	if is.header == defaultIdentityTokenHeader {
+		value = "Bearer " + token
+	}
+
+	// time claims are excluded from the key, so responses are cached per user
+	claims.IssuedAt, claims.NotBefore, claims.ExpiresAt = 0, 0, 0
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal identity claims: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return &userIdentity{
+		header: is.header,
+		value:  value,
+		key:    hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// signToken returns JWT with the given claims in compact serialization format
+func (is *identitySigner) signToken(claims identityClaims) (string, error) {
+	header := map[string]string{
+		"alg": is.algorithm,
+		"typ": "JWT",
+	}
+	if is.keyID != "" {
+		header["kid"] = is.keyID
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal token header: %w", err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal token claims: %w", err)
+	}
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(h) + "." + enc.EncodeToString(c)
+
+	var sig []byte
+	switch is.algorithm {
+	case identityAlgHS256:
+		mac := hmac.New(sha256.New, is.hmacKey)
+		mac.Write([]byte(signingInput))
+		sig = mac.Sum(nil)
+	case identityAlgRS256:
+		digest := sha256.Sum256([]byte(signingInput))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, is.rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", fmt.Errorf("cannot sign token: %w", err)
+		}
+	}
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
+
+// userIdentity returns the signed identity of the Grafana user from the plugin context.
+// It returns nil if identity tokens are disabled.
+func (gs *GrafanaSettings) userIdentity(pCtx backend.PluginContext) (*userIdentity, error) {
+	if gs.identitySigner == nil {
+		return nil, nil
+	}
+	var team string
+	if r := gs.matchTenantRule(pCtx); r != nil {
+		team = r.Name
+	}
+	id, err := gs.identitySigner.sign(pCtx, team, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("cannot create identity token: %w", err)
+	}
+	return id, nil
+}
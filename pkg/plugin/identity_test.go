@@ -0,0 +1,265 @@
+package plugin
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+const testHMACKey = "0123456789abcdef0123456789abcdef"
+
+// parseTestToken checks the token structure and returns its header, claims and signature
+func parseTestToken(t *testing.T, token string) (map[string]string, identityClaims, string, []byte) {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 parts of the token; got %d", len(parts))
+	}
+	enc := base64.RawURLEncoding
+	var header map[string]string
+	var claims identityClaims
+	for i, v := range []any{&header, &claims} {
+		data, err := enc.DecodeString(parts[i])
+		if err != nil {
+			t.Fatalf("cannot decode part #%d of the token: %s", i, err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("cannot unmarshal part #%d of the token: %s", i, err)
+		}
+	}
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("cannot decode signature: %s", err)
+	}
+	return header, claims, parts[0] + "." + parts[1], sig
+}
+
+func TestIdentitySigner_HS256(t *testing.T) {
+	is, err := IdentityTokenSettings{Enabled: true, Issuer: "grafana", Audience: "vmauth", KeyID: "k1", TTL: "1m"}.parse(testHMACKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	now := time.Unix(1700000000, 0)
+	pCtx := backend.PluginContext{OrgID: 2, User: &backend.User{Login: "alice", Email: "alice@example.com", Role: "Editor"}}
+	id, err := is.sign(pCtx, "team-a", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	h := http.Header{}
+	id.setHeader(h)
+	token, ok := strings.CutPrefix(h.Get("Authorization"), "Bearer ")
+	if !ok {
+		t.Fatalf("expected bearer token; got %q", h.Get("Authorization"))
+	}
+	header, claims, signingInput, sig := parseTestToken(t, token)
+	if header["alg"] != "HS256" || header["typ"] != "JWT" || header["kid"] != "k1" {
+		t.Fatalf("unexpected token header %v", header)
+	}
+	mac := hmac.New(sha256.New, []byte(testHMACKey))
+	mac.Write([]byte(signingInput))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		t.Fatalf("invalid token signature")
+	}
+	want := identityClaims{
+		Issuer:    "grafana",
+		Subject:   "alice",
+		Audience:  "vmauth",
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+		Login:     "alice",
+		Email:     "alice@example.com",
+		OrgID:     2,
+		Role:      "Editor",
+		Team:      "team-a",
+	}
+	if claims != want {
+		t.Fatalf("unexpected claims;\ngot\n%+v\nwant\n%+v", claims, want)
+	}
+
+	// the cache key of the identity doesn't depend on the time of the token
+	id2, err := is.sign(pCtx, "team-a", now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if id.value == id2.value || id.cacheKey() != id2.cacheKey() {
+		t.Fatalf("expected new token with the same cache key")
+	}
+	id3, err := is.sign(backend.PluginContext{OrgID: 2, User: &backend.User{Login: "bob"}}, "team-a", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if id.cacheKey() == id3.cacheKey() {
+		t.Fatalf("expected different cache keys for different users")
+	}
+}
+
+func TestIdentitySigner_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate key: %s", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal key: %s", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	is, err := IdentityTokenSettings{Enabled: true, Algorithm: "RS256", Header: "x-grafana-identity"}.parse(string(keyPEM))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	id, err := is.sign(backend.PluginContext{OrgID: 1}, "", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	h := http.Header{}
+	id.setHeader(h)
+	header, claims, signingInput, sig := parseTestToken(t, h.Get("X-Grafana-Identity"))
+	if header["alg"] != "RS256" {
+		t.Fatalf("unexpected alg %q", header["alg"])
+	}
+	digest := sha256.Sum256([]byte(signingInput))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatalf("invalid token signature: %s", err)
+	}
+	// alerting queries have no user, so the token contains only the organization
+	if claims.Subject != "" || claims.OrgID != 1 || claims.ExpiresAt-claims.IssuedAt != int64(defaultIdentityTokenTTL.Seconds()) {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestIdentityTokenSettings_parse(t *testing.T) {
+	is, err := IdentityTokenSettings{}.parse("")
+	if err != nil || is != nil {
+		t.Fatalf("expected nil signer for disabled identity tokens; got %v, %v", is, err)
+	}
+
+	f := func(s IdentityTokenSettings, key string) {
+		t.Helper()
+		s.Enabled = true
+		if _, err := s.parse(key); err == nil {
+			t.Fatalf("expected error for settings %+v", s)
+		}
+	}
+	f(IdentityTokenSettings{}, "")
+	f(IdentityTokenSettings{}, "short")
+	f(IdentityTokenSettings{Algorithm: "none"}, testHMACKey)
+	f(IdentityTokenSettings{Algorithm: "RS256"}, testHMACKey)
+	f(IdentityTokenSettings{TTL: "foo"}, testHMACKey)
+	f(IdentityTokenSettings{TTL: "-1m"}, testHMACKey)
+	f(IdentityTokenSettings{Header: "AccountID"}, testHMACKey)
+}
+
+func TestNewGrafanaSettings_identityTokenBasicAuth(t *testing.T) {
+	f := func(jsonData string, wantErr bool) {
+		t.Helper()
+		_, err := NewGrafanaSettings(backend.DataSourceInstanceSettings{
+			JSONData:                []byte(jsonData),
+			BasicAuthEnabled:        true,
+			DecryptedSecureJSONData: map[string]string{identityTokenKeyName: testHMACKey},
+		})
+		if (err != nil) != wantErr {
+			t.Fatalf("unexpected error for %s: %v", jsonData, err)
+		}
+	}
+
+	// basic auth overwrites the token in Authorization header
+	f(`{"identityToken":{"enabled":true}}`, true)
+	f(`{"identityToken":{"enabled":true,"header":"authorization"}}`, true)
+	f(`{"identityToken":{"enabled":true,"header":"X-Grafana-Identity"}}`, false)
+	f(`{"identityToken":{"enabled":false}}`, false)
+}
+
+func TestDatasource_identityToken(t *testing.T) {
+	var mu sync.Mutex
+	tokens := make(map[string]string)
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		tokens[r.URL.Path] = r.Header.Get("Authorization")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		_, _ = w.Write([]byte(`{"_msg":"foo","_time":"2024-02-20T14:04:27Z"}`))
+	})
+	mux.HandleFunc("/select/logsql/field_names", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		_, _ = w.Write([]byte(`{"values":[]}`))
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL:                     srv.URL,
+		JSONData:                []byte(`{"identityToken":{"enabled":true},"tenantMapping":[{"name":"team-a","users":["alice"],"tenant":"1:0"}]}`),
+		DecryptedSecureJSONData: map[string]string{identityTokenKeyName: testHMACKey},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	pCtx := backend.PluginContext{OrgID: 1, User: &backend.User{Login: "alice", Role: "Viewer"}}
+	now := time.Now()
+	rsp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		PluginContext: pCtx,
+		Queries: []backend.DataQuery{
+			{RefID: "A", TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now}, JSON: []byte(`{"expr":"*","queryType":"instant"}`)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if r := rsp.Responses["A"]; r.Error != nil {
+		t.Fatalf("unexpected error: %s", r.Error)
+	}
+
+	sender := backend.CallResourceResponseSenderFunc(func(_ *backend.CallResourceResponse) error { return nil })
+	err = ds.CallResource(context.Background(), &backend.CallResourceRequest{
+		PluginContext: pCtx,
+		Path:          "select/logsql/field_names",
+		URL:           "select/logsql/field_names?query=*",
+	}, sender)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{PluginContext: pCtx}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range []string{"/select/logsql/query", "/select/logsql/field_names", "/health"} {
+		token, ok := strings.CutPrefix(tokens[path], "Bearer ")
+		if !ok {
+			t.Fatalf("expected bearer token in %s request; got %q", path, tokens[path])
+		}
+		_, claims, _, _ := parseTestToken(t, token)
+		if claims.Login != "alice" || claims.OrgID != 1 || claims.Role != "Viewer" || claims.Team != "team-a" {
+			t.Fatalf("unexpected claims of %s request: %+v", path, claims)
+		}
+	}
+}
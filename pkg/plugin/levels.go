@@ -0,0 +1,229 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// Grafana log levels, see https://grafana.com/docs/grafana/latest/explore/logs-integration/#log-level
+	logLevelCritical = "critical"
+	logLevelError    = "error"
+	logLevelWarning  = "warning"
+	logLevelInfo     = "info"
+	logLevelDebug    = "debug"
+	logLevelTrace    = "trace"
+	logLevelUnknown  = "unknown"
+
+	// logLevelLabel is the label of logs volume series with the log level
+	logLevelLabel = "level"
+	// defaultLogsVolumeLevelField is the field which groups logs volume by default
+	defaultLogsVolumeLevelField = "level"
+	// logsVolumeTypeFullRange is set to the metadata of logs volume frames for Explore
+	logsVolumeTypeFullRange = "FullRange"
+	// syslogPriorityField is the field with syslog priority, which contains the facility and the severity
+	syslogPriorityField = "priority"
+)
+
+// defaultDetectedLevelFields contains fields checked by default to detect the level of log lines
+var defaultDetectedLevelFields = []string{"level", "severity", "lvl", "log.level", syslogPriorityField}
+
+// logLevels contains Grafana log levels from the most to the least severe
+var logLevels = []string{logLevelCritical, logLevelError, logLevelWarning, logLevelInfo, logLevelDebug, logLevelTrace, logLevelUnknown}
+
+// logLevelAliases maps lowercase values of level fields to Grafana log levels
+var logLevelAliases = map[string]string{
+	"emerg":         logLevelCritical,
+	"emergency":     logLevelCritical,
+	"alert":         logLevelCritical,
+	"crit":          logLevelCritical,
+	"critical":      logLevelCritical,
+	"fatal":         logLevelCritical,
+	"panic":         logLevelCritical,
+	"err":           logLevelError,
+	"eror":          logLevelError,
+	"error":         logLevelError,
+	"warn":          logLevelWarning,
+	"warning":       logLevelWarning,
+	"info":          logLevelInfo,
+	"information":   logLevelInfo,
+	"informational": logLevelInfo,
+	"notice":        logLevelInfo,
+	"dbug":          logLevelDebug,
+	"debug":         logLevelDebug,
+	"trace":         logLevelTrace,
+}
+
+// syslogSeverityLevels maps syslog severities from 0 (emergency) to 7 (debug) to Grafana log levels
+var syslogSeverityLevels = []string{
+	logLevelCritical, logLevelCritical, logLevelCritical,
+	logLevelError, logLevelWarning, logLevelInfo, logLevelInfo, logLevelDebug,
+}
+
+// logLevelColors contains colors of Grafana log levels
+var logLevelColors = map[string]string{
+	logLevelCritical: "#705da0",
+	logLevelError:    "#e24d42",
+	logLevelWarning:  "#eab839",
+	logLevelInfo:     "#7eb26d",
+	logLevelDebug:    "#1f78c1",
+	logLevelTrace:    "#6ed0e0",
+	logLevelUnknown:  "#8e8e8e",
+}
+
+// normalizeLogLevel returns Grafana log level for the value of the level field.
+// It returns unknown level for unrecognized values.
+func normalizeLogLevel(s string) string {
+	if l, ok := logLevelAliases[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return l
+	}
+	return logLevelUnknown
+}
+
+// levelDetector detects Grafana log levels of log lines
+type levelDetector struct {
+	fields []string
+	// messageRe matches level aliases as words in the message
+	messageRe *regexp.Regexp
+}
+
+// newLevelDetector returns levelDetector, which checks the given fields in order.
+// Default fields are used if fields are empty.
+func newLevelDetector(fields []string) *levelDetector {
+	ld := &levelDetector{}
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			ld.fields = append(ld.fields, f)
+		}
+	}
+	if len(ld.fields) == 0 {
+		ld.fields = defaultDetectedLevelFields
+	}
+
+	aliases := make([]string, 0, len(logLevelAliases))
+	for alias := range logLevelAliases {
+		aliases = append(aliases, regexp.QuoteMeta(alias))
+	}
+	// longer aliases go first, so that warning isn't matched as warn
+	sort.Slice(aliases, func(i, j int) bool {
+		if len(aliases[i]) != len(aliases[j]) {
+			return len(aliases[i]) > len(aliases[j])
+		}
+		return aliases[i] < aliases[j]
+	})
+	ld.messageRe = regexp.MustCompile(`(?i)\b(` + strings.Join(aliases, "|") + `)\b`)
+	return ld
+}
+
+// detect returns the level of the log line from the first field with a known level.
+// The level is searched in the message if no field contains it.
+func (ld *levelDetector) detect(labels data.Labels, message string) string {
+	for _, f := range ld.fields {
+		v, ok := labels[f]
+		if !ok {
+			continue
+		}
+		if level := normalizeLogLevel(v); level != logLevelUnknown {
+			return level
+		}
+		if level := syslogLogLevel(f, v); level != logLevelUnknown {
+			return level
+		}
+	}
+	// the leftmost level word is the most likely to be the level of the line
+	if m := ld.messageRe.FindString(message); m != "" {
+		return normalizeLogLevel(m)
+	}
+	return logLevelUnknown
+}
+
+// syslogLogLevel returns Grafana log level for numeric syslog severity.
+// The severity is taken from the priority if the field is syslog priority.
+func syslogLogLevel(field, value string) string {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return logLevelUnknown
+	}
+	if field == syslogPriorityField {
+		n %= 8
+	}
+	if n >= len(syslogSeverityLevels) {
+		return logLevelUnknown
+	}
+	return syslogSeverityLevels[n]
+}
+
+// logsVolumeFrameMeta contains custom metadata of logs volume frames
+type logsVolumeFrameMeta struct {
+	LogsVolumeType string `json:"logsVolumeType"`
+}
+
+// logsVolumeFrames merges hits frames grouped by the level field into a frame per Grafana log level.
+// Hits of values with the same level, e.g. err and ERROR, are summed up.
+func logsVolumeFrames(frames data.Frames, levelField string) (data.Frames, error) {
+	hitsByLevel := make(map[string]map[int64]float64)
+	for _, frame := range frames {
+		if len(frame.Fields) != 2 {
+			return nil, fmt.Errorf("failed to prepare logs volume: expected 2 fields in the frame; got %d", len(frame.Fields))
+		}
+		timeFd, valueFd := frame.Fields[0], frame.Fields[1]
+		if timeFd.Type() != data.FieldTypeTime || valueFd.Type() != data.FieldTypeFloat64 {
+			return nil, fmt.Errorf("failed to prepare logs volume: unexpected field types %s and %s", timeFd.Type(), valueFd.Type())
+		}
+
+		level := normalizeLogLevel(valueFd.Labels[levelField])
+		hits, ok := hitsByLevel[level]
+		if !ok {
+			hits = make(map[int64]float64)
+			hitsByLevel[level] = hits
+		}
+		for i := 0; i < timeFd.Len(); i++ {
+			ts := timeFd.At(i).(time.Time)
+			hits[ts.UnixNano()] += valueFd.At(i).(float64)
+		}
+	}
+
+	var res data.Frames
+	for _, level := range logLevels {
+		hits, ok := hitsByLevel[level]
+		if !ok {
+			continue
+		}
+		timestamps := make([]int64, 0, len(hits))
+		for ts := range hits {
+			timestamps = append(timestamps, ts)
+		}
+		sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+		timeFd := data.NewFieldFromFieldType(data.FieldTypeTime, len(timestamps))
+		timeFd.Name = gTimeField
+		valueFd := data.NewFieldFromFieldType(data.FieldTypeFloat64, len(timestamps))
+		valueFd.Name = gValueField
+		valueFd.Labels = data.Labels{logLevelLabel: level}
+		valueFd.Config = &data.FieldConfig{
+			DisplayNameFromDS: level,
+			Color: map[string]interface{}{
+				"mode":       "fixed",
+				"fixedColor": logLevelColors[level],
+			},
+		}
+		for i, ts := range timestamps {
+			timeFd.Set(i, time.Unix(0, ts).UTC())
+			valueFd.Set(i, hits[ts])
+		}
+
+		frame := data.NewFrame(level, timeFd, valueFd)
+		frame.Meta = &data.FrameMeta{
+			PreferredVisualization: data.VisTypeGraph,
+			Custom:                 logsVolumeFrameMeta{LogsVolumeType: logsVolumeTypeFullRange},
+		}
+		res = append(res, frame)
+	}
+	return res, nil
+}
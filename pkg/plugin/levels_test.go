@@ -0,0 +1,194 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestNormalizeLogLevel(t *testing.T) {
+	f := func(s, want string) {
+		t.Helper()
+		if got := normalizeLogLevel(s); got != want {
+			t.Fatalf("unexpected level for %q; got %q; want %q", s, got, want)
+		}
+	}
+
+	f("ERROR", logLevelError)
+	f("err", logLevelError)
+	f(" Error ", logLevelError)
+	f("warn", logLevelWarning)
+	f("WARNING", logLevelWarning)
+	f("fatal", logLevelCritical)
+	f("emerg", logLevelCritical)
+	f("notice", logLevelInfo)
+	f("INFO", logLevelInfo)
+	f("dbug", logLevelDebug)
+	f("trace", logLevelTrace)
+	f("", logLevelUnknown)
+	f("verbose", logLevelUnknown)
+}
+
+func TestLogsVolumeFrames(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	hitsFrame := func(level string, times []time.Time, values []float64) *data.Frame {
+		return data.NewFrame("",
+			data.NewField(gTimeField, nil, times),
+			data.NewField(gValueField, data.Labels{"severity": level}, values))
+	}
+
+	frames, err := logsVolumeFrames(data.Frames{
+		hitsFrame("info", []time.Time{t1, t2}, []float64{10, 20}),
+		hitsFrame("ERROR", []time.Time{t2}, []float64{1}),
+		hitsFrame("err", []time.Time{t1, t2}, []float64{2, 3}),
+		hitsFrame("", []time.Time{t1}, []float64{5}),
+	}, "severity")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	type series struct {
+		level  string
+		times  []time.Time
+		values []float64
+	}
+	want := []series{
+		{level: logLevelError, times: []time.Time{t1, t2}, values: []float64{2, 4}},
+		{level: logLevelInfo, times: []time.Time{t1, t2}, values: []float64{10, 20}},
+		{level: logLevelUnknown, times: []time.Time{t1}, values: []float64{5}},
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("expected %d frames; got %d", len(want), len(frames))
+	}
+	for i, w := range want {
+		frame := frames[i]
+		valueFd := frame.Fields[1]
+		if frame.Name != w.level || valueFd.Labels[logLevelLabel] != w.level || valueFd.Config.DisplayNameFromDS != w.level {
+			t.Fatalf("unexpected level of frame #%d: %q, %v", i, frame.Name, valueFd.Labels)
+		}
+		if valueFd.Config.Color["fixedColor"] != logLevelColors[w.level] {
+			t.Fatalf("unexpected color of %s level: %v", w.level, valueFd.Config.Color)
+		}
+		if meta, ok := frame.Meta.Custom.(logsVolumeFrameMeta); !ok || meta.LogsVolumeType != logsVolumeTypeFullRange {
+			t.Fatalf("unexpected metadata of %s level: %v", w.level, frame.Meta.Custom)
+		}
+		if frame.Rows() != len(w.times) {
+			t.Fatalf("expected %d points of %s level; got %d", len(w.times), w.level, frame.Rows())
+		}
+		for j := range w.times {
+			ts := frame.Fields[0].At(j).(time.Time)
+			v := valueFd.At(j).(float64)
+			if !ts.Equal(w.times[j]) || v != w.values[j] {
+				t.Fatalf("unexpected point #%d of %s level: %s %v", j, w.level, ts, v)
+			}
+		}
+	}
+
+	if _, err := logsVolumeFrames(data.Frames{data.NewFrame("", data.NewField(gTimeField, nil, []time.Time{}))}, "level"); err == nil {
+		t.Fatalf("expected error for the frame without value field")
+	}
+}
+
+func TestDatasource_logsVolumeQuery(t *testing.T) {
+	var field string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		field = r.FormValue("field")
+		_ = json.NewEncoder(w).Encode(HitsResponse{Hits: []Hit{
+			{Fields: map[string]string{"lvl": "warn"}, Timestamps: []string{"2024-01-01T00:00:00Z"}, Values: []float64{1}},
+			{Fields: map[string]string{"lvl": "WARNING"}, Timestamps: []string{"2024-01-01T00:00:00Z"}, Values: []float64{2}},
+		}})
+	}))
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{URL: srv.URL, JSONData: []byte(`{"logsVolumeLevelField":"lvl"}`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	rsp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{{
+			RefID:     "log-volume-A",
+			TimeRange: backend.TimeRange{From: time.Unix(0, 0), To: time.Now()},
+			JSON:      []byte(`{"expr":"*","queryType":"hits","field":"_stream","step":"1m","supportingQueryType":"logsVolume"}`),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	r := rsp.Responses["log-volume-A"]
+	if r.Error != nil {
+		t.Fatalf("unexpected error: %s", r.Error)
+	}
+	if field != "lvl" {
+		t.Fatalf("expected hits grouped by the level field; got %q", field)
+	}
+	if len(r.Frames) != 1 || r.Frames[0].Name != logLevelWarning || r.Frames[0].Fields[1].At(0).(float64) != 3 {
+		t.Fatalf("expected hits of warning level; got %v", r.Frames)
+	}
+}
+
+func TestLevelDetector_detect(t *testing.T) {
+	f := func(fields []string, labels data.Labels, message, want string) {
+		t.Helper()
+		if got := newLevelDetector(fields).detect(labels, message); got != want {
+			t.Fatalf("unexpected level for %v %q; got %q; want %q", labels, message, got, want)
+		}
+	}
+
+	// level fields are checked in order
+	f(nil, data.Labels{"level": "WARN", "severity": "error"}, "", logLevelWarning)
+	f(nil, data.Labels{"severity": "err"}, "", logLevelError)
+	f(nil, data.Labels{"log.level": "dbug"}, "", logLevelDebug)
+	f([]string{"sev", " level "}, data.Labels{"level": "info", "sev": "fatal"}, "", logLevelCritical)
+
+	// unknown values are skipped
+	f(nil, data.Labels{"level": "verbose", "lvl": "trace"}, "", logLevelTrace)
+
+	// syslog severity and priority
+	f(nil, data.Labels{"severity": "3"}, "", logLevelError)
+	f(nil, data.Labels{"severity": "9"}, "", logLevelUnknown)
+	f(nil, data.Labels{"priority": "14"}, "", logLevelInfo)
+	f(nil, data.Labels{"priority": "8"}, "", logLevelCritical)
+
+	// message content
+	f(nil, data.Labels{"app": "api"}, "2024-01-01 WARNING: disk is almost full, error is possible", logLevelWarning)
+	f(nil, data.Labels{"level": "verbose"}, "request failed: [ERR] timeout", logLevelError)
+	f(nil, nil, "errors aren't levels", logLevelUnknown)
+	f([]string{"level"}, data.Labels{"severity": "error"}, "", logLevelUnknown)
+}
+
+func TestParseInstantResponse_detectedLevel(t *testing.T) {
+	response := `{"_time":"2024-01-01T00:00:00Z","_msg":"started","_stream":"{app=\"api\"}","level":"INFO"}
+{"_time":"2024-01-01T00:00:01Z","_msg":"panic: nil map","_stream":"{app=\"api\"}"}
+{"_time":"2024-01-01T00:00:02Z","_msg":"done","_stream":"{app=\"api\"}"}`
+
+	rsp := parseInstantResponse(strings.NewReader(response), newLineCounters("test"), logsParseOptions{levels: newLevelDetector(nil)})
+	if rsp.Error != nil {
+		t.Fatalf("unexpected error: %s", rsp.Error)
+	}
+	frame := rsp.Frames[0]
+	levelFd, _ := frame.FieldByName(gDetectedLevelField)
+	if levelFd == nil {
+		t.Fatalf("expected %s field in the frame", gDetectedLevelField)
+	}
+	want := []string{logLevelInfo, logLevelCritical, logLevelUnknown}
+	for i, w := range want {
+		if got := levelFd.At(i).(string); got != w {
+			t.Fatalf("unexpected level of line #%d; got %q; want %q", i, got, w)
+		}
+	}
+
+	rsp = parseInstantResponse(strings.NewReader(response), newLineCounters("test"), logsParseOptions{})
+	if _, idx := rsp.Frames[0].FieldByName(gDetectedLevelField); idx >= 0 {
+		t.Fatalf("unexpected %s field without the level detector", gDetectedLevelField)
+	}
+}
@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxConcurrentRequests = 16
+	defaultQueueTimeout          = time.Minute
+)
+
+// errQueueTimeout is returned when the request can't be sent to the datasource
+// because all slots for concurrent requests are busy during the queue timeout
+var errQueueTimeout = errors.New("too many concurrent requests to the datasource")
+
+// requestLimiter limits the number of concurrent requests to the datasource.
+// Requests which exceed the limit wait in the queue for the queue timeout.
+type requestLimiter struct {
+	ch           chan struct{}
+	queueTimeout time.Duration
+}
+
+// newRequestLimiter returns a new requestLimiter
+func newRequestLimiter(limit int, queueTimeout time.Duration) *requestLimiter {
+	return &requestLimiter{
+		ch:           make(chan struct{}, limit),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// acquire waits for a free slot and returns the function which releases it
+func (l *requestLimiter) acquire(ctx context.Context) (func(), error) {
+	select {
+	case l.ch <- struct{}{}:
+		return l.release, nil
+	default:
+	}
+
+	t := time.NewTimer(l.queueTimeout)
+	defer t.Stop()
+	select {
+	case l.ch <- struct{}{}:
+		return l.release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-t.C:
+		return nil, fmt.Errorf("%w: max %d concurrent requests, waited for %s", errQueueTimeout, cap(l.ch), l.queueTimeout)
+	}
+}
+
+func (l *requestLimiter) release() {
+	<-l.ch
+}
+
+// inFlight returns the number of requests which hold the slot
+func (l *requestLimiter) inFlight() int {
+	return len(l.ch)
+}
+
+// releaseOnClose releases the slot of the limiter when the response body is closed,
+// so the slot is held until the response is read
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
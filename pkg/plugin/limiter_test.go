@@ -0,0 +1,157 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	l := newRequestLimiter(2, 10*time.Millisecond)
+	ctx := context.Background()
+
+	release1, err := l.acquire(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := l.acquire(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if l.inFlight() != 2 {
+		t.Fatalf("expected 2 in-flight requests; got %d", l.inFlight())
+	}
+
+	_, err = l.acquire(ctx)
+	if !errors.Is(err, errQueueTimeout) {
+		t.Fatalf("expected queue timeout error; got %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := l.acquire(canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled error; got %v", err)
+	}
+
+	// the queued request gets the slot as soon as it is released
+	go func() {
+		time.Sleep(time.Millisecond)
+		release1()
+	}()
+	l.queueTimeout = time.Second
+	if _, err := l.acquire(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestDatasource_QueryDataConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, _ *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"_msg":"123","_time":"2024-02-20T14:04:27Z"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL:      srv.URL,
+		JSONData: []byte(`{"maxConcurrentRequests":2,"queueTimeout":"10s"}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	var queries []backend.DataQuery
+	for i := 0; i < 20; i++ {
+		queries = append(queries, backend.DataQuery{
+			RefID: fmt.Sprintf("Q%d", i),
+			JSON:  []byte(`{"expr":"*","queryType":"instant","maxLines":10}`),
+		})
+	}
+	rsp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: queries})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rsp.Responses) != len(queries) {
+		t.Fatalf("expected %d responses; got %d", len(queries), len(rsp.Responses))
+	}
+	for refID, r := range rsp.Responses {
+		if r.Error != nil {
+			t.Fatalf("unexpected error for %s: %s", refID, r.Error)
+		}
+	}
+	if got := maxInFlight.Load(); got > 2 {
+		t.Fatalf("expected at most 2 concurrent requests; got %d", got)
+	}
+	if ds.limiter.inFlight() != 0 {
+		t.Fatalf("expected all slots to be released; got %d", ds.limiter.inFlight())
+	}
+}
+
+func TestDatasource_sendRequestReleasesSlotBetweenAttempts(t *testing.T) {
+	var failed atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query") == "flaky" && failed.CompareAndSwap(false, true) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"_msg":"123","_time":"2024-02-20T14:04:27Z"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL:      srv.URL,
+		JSONData: []byte(`{"maxConcurrentRequests":1,"queueTimeout":"200ms","retryPolicy":{"maxAttempts":2,"initialBackoff":"1s","maxBackoff":"1s"}}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	flakyErr := make(chan error, 1)
+	go func() {
+		r, err := ds.sendRequest(context.Background(), srv.URL+"/select/logsql/query?query=flaky", nil, false)
+		if err == nil {
+			err = r.Close()
+		}
+		flakyErr <- err
+	}()
+
+	// wait until the flaky request fails and sleeps before the next attempt
+	for !failed.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// the slot must be free while the flaky request waits for the next attempt
+	r, err := ds.sendRequest(context.Background(), srv.URL+"/select/logsql/query?query=*", nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_ = r.Close()
+
+	if err := <-flakyErr; err != nil {
+		t.Fatalf("unexpected error of the retried request: %s", err)
+	}
+	if ds.limiter.inFlight() != 0 {
+		t.Fatalf("expected all slots to be released; got %d", ds.limiter.inFlight())
+	}
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics are registered in the default prometheus registry,
+// which is exposed by the plugin SDK via CollectMetrics.
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "query_duration_seconds",
+		Help:      "The duration of queries including retries, caching and parsing of the response",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"datasource_uid", "query_type"})
+	upstreamResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "upstream_responses_total",
+		Help:      "The number of responses from VictoriaLogs by status code. Requests failed without response have the code 'error'",
+	}, []string{"datasource_uid", "code"})
+	upstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "upstream_retries_total",
+		Help:      "The number of retried requests to VictoriaLogs",
+	}, []string{"datasource_uid"})
+	upstreamResponseBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "upstream_response_bytes_total",
+		Help:      "The number of bytes read from responses of VictoriaLogs",
+	}, []string{"datasource_uid"})
+	parsedLines = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "parsed_log_lines_total",
+		Help:      "The number of log lines parsed from responses of log queries and live tailing",
+	}, []string{"datasource_uid"})
+	skippedLines = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "skipped_log_lines_total",
+		Help:      "The number of log lines skipped because they exceed the read buffer",
+	}, []string{"datasource_uid"})
+	inflightRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "inflight_requests",
+		Help:      "The number of requests to VictoriaLogs which are in progress, except live tailing requests",
+	}, []string{"datasource_uid"})
+	activeStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "victorialogs_datasource",
+		Name:      "active_live_tail_streams",
+		Help:      "The number of active live tailing streams",
+	}, []string{"datasource_uid"})
+)
+
+// datasourceMetrics contains metrics of the datasource instance
+type datasourceMetrics struct {
+	uid           string
+	retries       prometheus.Counter
+	responseBytes prometheus.Counter
+	inflight      prometheus.Gauge
+	activeStreams prometheus.Gauge
+	lines         lineCounters
+}
+
+// lineCounters counts log lines of the parsed responses
+type lineCounters struct {
+	parsed  prometheus.Counter
+	skipped prometheus.Counter
+}
+
+// newDatasourceMetrics returns metrics for the datasource with the given uid
+func newDatasourceMetrics(datasourceUID string) *datasourceMetrics {
+	return &datasourceMetrics{
+		uid:           datasourceUID,
+		retries:       upstreamRetries.WithLabelValues(datasourceUID),
+		responseBytes: upstreamResponseBytes.WithLabelValues(datasourceUID),
+		inflight:      inflightRequests.WithLabelValues(datasourceUID),
+		activeStreams: activeStreams.WithLabelValues(datasourceUID),
+		lines:         newLineCounters(datasourceUID),
+	}
+}
+
+// newLineCounters returns line counters for the datasource with the given uid
+func newLineCounters(datasourceUID string) lineCounters {
+	return lineCounters{
+		parsed:  parsedLines.WithLabelValues(datasourceUID),
+		skipped: skippedLines.WithLabelValues(datasourceUID),
+	}
+}
+
+// observeQuery records the duration of the query since start
+func (m *datasourceMetrics) observeQuery(queryType QueryType, start time.Time) {
+	if queryType == "" {
+		queryType = QueryTypeInstant
+	}
+	queryDuration.WithLabelValues(m.uid, string(queryType)).Observe(time.Since(start).Seconds())
+}
+
+// countResponse counts the response of VictoriaLogs by its status code.
+// Zero status code means the request failed without response.
+func (m *datasourceMetrics) countResponse(statusCode int) {
+	code := "error"
+	if statusCode > 0 {
+		code = strconv.Itoa(statusCode)
+	}
+	upstreamResponses.WithLabelValues(m.uid, code).Inc()
+}
+
+// countingReadCloser counts the number of bytes read from the response body
+type countingReadCloser struct {
+	io.ReadCloser
+	counter prometheus.Counter
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.counter.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,114 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestDatasource_metrics(t *testing.T) {
+	const uid = "test-metrics"
+
+	var calls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"_msg":"foo","_time":"2024-02-20T14:04:27Z"}` + "\n" + `{"_msg":"bar","_time":"2024-02-20T14:04:28Z"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		UID:      uid,
+		URL:      srv.URL,
+		JSONData: []byte(`{"retryPolicy":{"initialBackoff":"1ms"}}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	now := time.Now()
+	rsp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+				JSON:      []byte(`{"expr":"*","queryType":"instant"}`),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if r := rsp.Responses["A"]; r.Error != nil {
+		t.Fatalf("unexpected response error: %s", r.Error)
+	}
+
+	f := func(name string, c prometheus.Counter, want float64) {
+		t.Helper()
+		if got := counterValue(t, c); got != want {
+			t.Fatalf("unexpected value of %s; got %v; want %v", name, got, want)
+		}
+	}
+	f("upstream_responses_total{code=503}", upstreamResponses.WithLabelValues(uid, "503"), 1)
+	f("upstream_responses_total{code=200}", upstreamResponses.WithLabelValues(uid, "200"), 1)
+	f("upstream_retries_total", upstreamRetries.WithLabelValues(uid), 1)
+	f("parsed_log_lines_total", parsedLines.WithLabelValues(uid), 2)
+	f("skipped_log_lines_total", skippedLines.WithLabelValues(uid), 0)
+	if got := counterValue(t, upstreamResponseBytes.WithLabelValues(uid)); got == 0 {
+		t.Fatalf("expected response bytes to be counted")
+	}
+
+	var m dto.Metric
+	if err := inflightRequests.WithLabelValues(uid).Write(&m); err != nil {
+		t.Fatalf("cannot read gauge: %s", err)
+	}
+	if got := m.GetGauge().GetValue(); got != 0 {
+		t.Fatalf("expected no in-flight requests; got %v", got)
+	}
+
+	h, err := queryDuration.GetMetricWithLabelValues(uid, string(QueryTypeInstant))
+	if err != nil {
+		t.Fatalf("cannot get histogram: %s", err)
+	}
+	m.Reset()
+	if err := h.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("cannot read histogram: %s", err)
+	}
+	if got := m.GetHistogram().GetSampleCount(); got != 1 {
+		t.Fatalf("expected 1 observed query; got %d", got)
+	}
+
+	// metrics must be exposed via the default gatherer, which is used by the plugin SDK for CollectMetrics
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("cannot gather metrics: %s", err)
+	}
+	found := make(map[string]bool)
+	for _, mf := range mfs {
+		found[mf.GetName()] = true
+	}
+	for _, name := range []string{
+		"victorialogs_datasource_query_duration_seconds",
+		"victorialogs_datasource_upstream_responses_total",
+		"victorialogs_datasource_upstream_retries_total",
+		"victorialogs_datasource_upstream_response_bytes_total",
+		"victorialogs_datasource_parsed_log_lines_total",
+		"victorialogs_datasource_inflight_requests",
+	} {
+		if !found[name] {
+			t.Fatalf("expected metric %q to be exposed", name)
+		}
+	}
+}
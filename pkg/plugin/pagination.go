@@ -0,0 +1,157 @@
+package plugin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// logsCursor points to the boundary of the returned page of log lines.
+// Lines with the boundary timestamp can be split between pages,
+// so hashes of the returned lines with this timestamp are kept in the cursor
+// and these lines are skipped in the next page.
+type logsCursor struct {
+	// Time is the timestamp of the last returned line in nanoseconds
+	Time int64 `json:"t"`
+	// Seen contains hashes of the returned lines with the boundary timestamp
+	Seen []string `json:"s,omitempty"`
+}
+
+// logsFrameMeta contains custom metadata of the log frame
+type logsFrameMeta struct {
+	// Cursor is the cursor of the next page of log lines.
+	// It is empty if there are no more lines in the time range.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// parseLogsCursor decodes the cursor returned in the metadata of the previous page
+func parseLogsCursor(s string) (*logsCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode cursor %q: %w", s, err)
+	}
+	var c logsCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("cannot parse cursor %q: %w", s, err)
+	}
+	if c.Time <= 0 {
+		return nil, fmt.Errorf("cannot parse cursor %q: timestamp must be positive", s)
+	}
+	return &c, nil
+}
+
+// String returns the cursor encoded for the frame metadata
+func (c *logsCursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// apply limits the time range of the query by the cursor boundary.
+// The boundary is included into the time range, so the limit of the query is increased
+// by the number of already returned lines with the boundary timestamp.
+func (c *logsCursor) apply(q *Query) {
+	if c == nil {
+		return
+	}
+	boundary := time.Unix(0, c.Time)
+	if q.isForward() {
+		if boundary.After(q.TimeRange.From) {
+			q.TimeRange.From = boundary
+		}
+	} else if boundary.Before(q.TimeRange.To) {
+		q.TimeRange.To = boundary
+	}
+	q.MaxLines += len(c.Seen)
+}
+
+// paginateLogFrame removes the lines returned in the previous page from the frame
+// sorted in the query direction and limits the frame by the given number of lines.
+// It returns the cursor of the next page or nil if there are no more lines.
+func paginateLogFrame(frame *data.Frame, cursor *logsCursor, limit int) (*data.Frame, *logsCursor, error) {
+	timeIdx := logsTimeFieldIdx(frame)
+	if timeIdx < 0 {
+		return nil, nil, fmt.Errorf("failed to paginate frame: frame doesn't contain %q field", gTimeField)
+	}
+	rows, err := frame.RowLen()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to paginate frame: %w", err)
+	}
+
+	seen := make(map[string]int)
+	if cursor != nil {
+		for _, h := range cursor.Seen {
+			seen[h]++
+		}
+	}
+
+	page := frame.EmptyCopy()
+	page.Meta = frame.Meta
+	for i, f := range frame.Fields {
+		page.Fields[i].Config = f.Config
+	}
+	next := &logsCursor{}
+	for i := 0; i < rows && page.Rows() < limit; i++ {
+		ts, _ := frame.Fields[timeIdx].At(i).(time.Time)
+		h := logLineHash(frame, i)
+		if cursor != nil && ts.UnixNano() == cursor.Time && seen[h] > 0 {
+			seen[h]--
+			continue
+		}
+		page.AppendRow(frame.RowCopy(i)...)
+
+		if ts.UnixNano() != next.Time {
+			next = &logsCursor{Time: ts.UnixNano()}
+			if cursor != nil && next.Time == cursor.Time {
+				// lines with the same timestamp were returned in the previous pages
+				next.Seen = append(next.Seen, cursor.Seen...)
+			}
+		}
+		next.Seen = append(next.Seen, h)
+	}
+
+	if page.Rows() < limit {
+		// all lines of the time range are returned
+		return page, nil, nil
+	}
+	return page, next, nil
+}
+
+// logLineHash returns the hash of the log line, which identifies lines with the same timestamp
+func logLineHash(frame *data.Frame, row int) string {
+	h := fnv.New64a()
+	for _, f := range frame.Fields {
+		v, ok := f.ConcreteAt(row)
+		if !ok {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			h.Write([]byte(v))
+		case json.RawMessage:
+			h.Write(v)
+		default:
+			_, _ = fmt.Fprint(h, v)
+		}
+		h.Write([]byte{0})
+	}
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// setLogsCursor sets the cursor of the next page to the frame metadata
+func setLogsCursor(frame *data.Frame, cursor *logsCursor) {
+	if cursor == nil {
+		return
+	}
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	frame.Meta.Custom = logsFrameMeta{Cursor: cursor.String()}
+}
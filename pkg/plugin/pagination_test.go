@@ -0,0 +1,176 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestParseLogsCursor(t *testing.T) {
+	c, err := parseLogsCursor("")
+	if err != nil || c != nil {
+		t.Fatalf("expected nil cursor; got %v, %v", c, err)
+	}
+
+	want := &logsCursor{Time: 1704067200000000001, Seen: []string{"a", "b"}}
+	got, err := parseLogsCursor(want.String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got.Time != want.Time || len(got.Seen) != 2 || got.Seen[0] != "a" || got.Seen[1] != "b" {
+		t.Fatalf("unexpected cursor %+v", got)
+	}
+
+	for _, s := range []string{"!!!", "e30", "bm90IGpzb24"} {
+		if _, err := parseLogsCursor(s); err == nil {
+			t.Fatalf("expected error for cursor %q", s)
+		}
+	}
+}
+
+func TestLogsCursor_apply(t *testing.T) {
+	from := time.Unix(100, 0)
+	to := time.Unix(200, 0)
+	c := &logsCursor{Time: time.Unix(150, 5).UnixNano(), Seen: []string{"a", "b"}}
+
+	q := &Query{DataQuery: backend.DataQuery{TimeRange: backend.TimeRange{From: from, To: to}}, MaxLines: 10}
+	c.apply(q)
+	if !q.TimeRange.From.Equal(from) || !q.TimeRange.To.Equal(time.Unix(150, 5)) || q.MaxLines != 12 {
+		t.Fatalf("unexpected query for backward direction: %v, %d", q.TimeRange, q.MaxLines)
+	}
+
+	q = &Query{DataQuery: backend.DataQuery{TimeRange: backend.TimeRange{From: from, To: to}}, MaxLines: 10, Direction: QueryDirectionForward}
+	c.apply(q)
+	if !q.TimeRange.From.Equal(time.Unix(150, 5)) || !q.TimeRange.To.Equal(to) || q.MaxLines != 12 {
+		t.Fatalf("unexpected query for forward direction: %v, %d", q.TimeRange, q.MaxLines)
+	}
+}
+
+// newPaginationServer returns the server which emulates VictoriaLogs:
+// it returns the newest lines of the time range for the limit
+// or the oldest lines if the query is sorted by _time
+func newPaginationServer(t *testing.T, lines []time.Time) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parse := func(name string) time.Time {
+			v := r.FormValue(name)
+			if ts, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return ts
+			}
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				t.Errorf("cannot parse %s param %q", name, v)
+			}
+			return time.Unix(n, 0)
+		}
+		start, end := parse("start"), parse("end")
+		limit, err := strconv.Atoi(r.FormValue("limit"))
+		if err != nil {
+			t.Errorf("cannot parse limit: %s", err)
+		}
+		forward := strings.Contains(r.FormValue("query"), "| sort by (_time)")
+		var selected []int
+		for n := 0; n < len(lines) && len(selected) < limit; n++ {
+			i := len(lines) - 1 - n
+			if forward {
+				i = n
+			}
+			if !lines[i].Before(start) && !lines[i].After(end) {
+				selected = append(selected, i)
+			}
+		}
+		// VictoriaLogs doesn't sort the returned lines
+		sort.Ints(selected)
+		for _, i := range selected {
+			_, _ = fmt.Fprintf(w, `{"_msg":"line %d","_time":"%s"}`+"\n", i, lines[i].Format(time.RFC3339Nano))
+		}
+	}))
+}
+
+func TestDatasource_pagedQuery(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var lines []time.Time
+	for i := 0; i < 10; i++ {
+		lines = append(lines, base.Add(time.Duration(i)*time.Millisecond))
+	}
+	// lines with the same timestamp are split between pages
+	for i := 0; i < 5; i++ {
+		lines = append(lines, base.Add(10*time.Millisecond))
+	}
+	for i := 0; i < 3; i++ {
+		lines = append(lines, base.Add(10*time.Millisecond+time.Duration(i+1)))
+	}
+
+	srv := newPaginationServer(t, lines)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{URL: srv.URL, JSONData: []byte(`{}`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	f := func(direction QueryDirection) {
+		t.Helper()
+		seen := make(map[string]bool)
+		var cursor string
+		var prev time.Time
+		for pages := 0; ; pages++ {
+			if pages > len(lines) {
+				t.Fatalf("too many pages")
+			}
+			q := &Query{
+				DataQuery: backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: base.Add(-time.Hour), To: base.Add(time.Hour)}},
+				Expr:      "*",
+				MaxLines:  3,
+				QueryType: QueryTypeInstant,
+				Direction: direction,
+				Cursor:    cursor,
+			}
+			if err := q.validate(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			rsp := ds.query(context.Background(), q)
+			if rsp.Error != nil {
+				t.Fatalf("unexpected error: %s", rsp.Error)
+			}
+			frame := rsp.Frames[0]
+			if frame.Rows() > 3 {
+				t.Fatalf("expected at most 3 lines in the page; got %d", frame.Rows())
+			}
+			for i := 0; i < frame.Rows(); i++ {
+				line := frame.Fields[1].At(i).(string)
+				if seen[line] {
+					t.Fatalf("duplicate %q in page #%d", line, pages)
+				}
+				seen[line] = true
+				ts := frame.Fields[0].At(i).(time.Time)
+				if !prev.IsZero() && direction == QueryDirectionBackward && ts.After(prev) {
+					t.Fatalf("lines must be sorted from the newest to the oldest: %s > %s", ts, prev)
+				}
+				if !prev.IsZero() && direction == QueryDirectionForward && ts.Before(prev) {
+					t.Fatalf("lines must be sorted from the oldest to the newest: %s < %s", ts, prev)
+				}
+				prev = ts
+			}
+
+			meta, ok := frame.Meta.Custom.(logsFrameMeta)
+			if !ok {
+				break
+			}
+			cursor = meta.Cursor
+		}
+		if len(seen) != len(lines) {
+			t.Fatalf("expected %d lines in all pages; got %d", len(lines), len(seen))
+		}
+	}
+	f(QueryDirectionBackward)
+	f(QueryDirectionForward)
+}
@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
 	"path"
 	"regexp"
@@ -22,6 +23,7 @@ const (
 	statsQueryPath      = "/select/logsql/stats_query"
 	statsQueryRangePath = "/select/logsql/stats_query_range"
 	hitsQueryPath       = "/select/logsql/hits"
+	streamIDsQueryPath  = "/select/logsql/stream_ids"
 	defaultMaxLines     = 1000
 	legendFormatAuto    = "__auto"
 	metricsName         = "__name__"
@@ -40,23 +42,157 @@ const (
 	QueryTypeStatsRange QueryType = "statsRange"
 	// QueryTypeHits represents hits query type
 	QueryTypeHits QueryType = "hits"
+	// QueryTypeStreams represents streams query type
+	QueryTypeStreams QueryType = "streams"
+	// QueryTypeStreamIDs represents stream ids query type
+	QueryTypeStreamIDs QueryType = "streamIDs"
+	// QueryTypeFieldNames represents field names query type
+	QueryTypeFieldNames QueryType = "fieldNames"
+	// QueryTypeFieldValues represents field values query type
+	QueryTypeFieldValues QueryType = "fieldValues"
+)
+
+// QueryDirection defines the order of log lines in the response
+type QueryDirection string
+
+const (
+	// QueryDirectionBackward returns the newest log lines first
+	QueryDirectionBackward QueryDirection = "backward"
+	// QueryDirectionForward returns the oldest log lines first
+	QueryDirectionForward QueryDirection = "forward"
+)
+
+// SupportingQueryType defines the supporting query of Explore
+type SupportingQueryType string
+
+const (
+	// SupportingQueryTypeLogsVolume represents the logs volume query of Explore
+	SupportingQueryTypeLogsVolume SupportingQueryType = "logsVolume"
+)
+
+// QueryFormat defines the format of log lines in the response
+type QueryFormat string
+
+const (
+	// QueryFormatLogs returns log lines in the log frame
+	QueryFormatLogs QueryFormat = "logs"
+	// QueryFormatAnnotations returns log lines as annotations
+	QueryFormatAnnotations QueryFormat = "annotations"
+	// QueryFormatTable returns log lines as a table with a column per field
+	QueryFormatTable QueryFormat = "table"
 )
 
 // Query represents backend query object
 type Query struct {
 	backend.DataQuery `json:"inline"`
 
-	Expr         string    `json:"expr"`
-	LegendFormat string    `json:"legendFormat"`
-	TimeInterval string    `json:"timeInterval"`
-	Interval     string    `json:"interval"`
-	IntervalMs   int64     `json:"intervalMs"`
-	MaxLines     int       `json:"maxLines"`
-	Step         string    `json:"step"`
-	Field        string    `json:"field"`
-	QueryType    QueryType `json:"queryType"`
+	Expr         string         `json:"expr"`
+	LegendFormat string         `json:"legendFormat"`
+	TimeInterval string         `json:"timeInterval"`
+	Interval     string         `json:"interval"`
+	IntervalMs   int64          `json:"intervalMs"`
+	MaxLines     int            `json:"maxLines"`
+	Step         string         `json:"step"`
+	Field        string         `json:"field"`
+	QueryType    QueryType      `json:"queryType"`
+	Direction    QueryDirection `json:"direction"`
+	Format       QueryFormat    `json:"format"`
+	Cursor       string         `json:"cursor"` // the cursor of the next page from the metadata of the previous log frame
+	Tenant       string         `json:"tenant"` // overrides the tenant of the datasource in AccountID:ProjectID format
 	url          *url.URL
 	ForAlerting  bool `json:"-"`
+	// Annotation maps fields of log lines to annotations in annotations format
+	Annotation AnnotationOptions `json:"annotation"`
+	// Table defines columns of log lines in table format
+	Table TableOptions `json:"table"`
+	// SupportingQueryType is set by Explore for supporting queries, e.g. logs volume
+	SupportingQueryType SupportingQueryType `json:"supportingQueryType"`
+
+	// alignToStep aligns the time range of range queries to the step,
+	// so the same requests are built for the moving time range
+	alignToStep bool
+	// forwardedHeaders contains headers of the Grafana request,
+	// which are forwarded to the datasource according to the forwarding settings
+	forwardedHeaders http.Header
+	// tenant is the resolved tenant of the query
+	tenant tenantID
+	// extraFilters are set to the query args, so they can't be overridden by the query
+	extraFilters extraFilters
+	// identity is the signed identity of the Grafana user if identity tokens are enabled
+	identity *userIdentity
+	// cursor is the parsed Cursor of the log query
+	cursor *logsCursor
+}
+
+// validate checks the query before it is sent to the datasource
+func (q *Query) validate() error {
+	switch q.QueryType {
+	case QueryTypeStats:
+		if strings.TrimSpace(q.Expr) == "" {
+			return fmt.Errorf("expr can't be empty for %s query", q.QueryType)
+		}
+	case QueryTypeStatsRange:
+		if strings.TrimSpace(q.Expr) == "" {
+			return fmt.Errorf("expr can't be empty for %s query", q.QueryType)
+		}
+		return validateStep(q.Step)
+	case QueryTypeHits:
+		if q.Field == "" {
+			return fmt.Errorf("field can't be empty for %s query", q.QueryType)
+		}
+		return validateStep(q.Step)
+	case QueryTypeStreams, QueryTypeStreamIDs, QueryTypeFieldNames:
+		return nil
+	case QueryTypeFieldValues:
+		if q.Field == "" {
+			return fmt.Errorf("field can't be empty for %s query", q.QueryType)
+		}
+		return nil
+	}
+	// other query types are executed as instant queries
+	switch q.Direction {
+	case "", QueryDirectionBackward, QueryDirectionForward:
+	default:
+		return fmt.Errorf("unsupported direction %q; supported directions: %s, %s", q.Direction, QueryDirectionBackward, QueryDirectionForward)
+	}
+	switch q.Format {
+	case "", QueryFormatLogs, QueryFormatAnnotations, QueryFormatTable:
+	default:
+		return fmt.Errorf("unsupported format %q; supported formats: %s, %s, %s", q.Format, QueryFormatLogs, QueryFormatAnnotations, QueryFormatTable)
+	}
+	var err error
+	q.cursor, err = parseLogsCursor(q.Cursor)
+	return err
+}
+
+// isLogsQuery returns true if the query returns log lines
+func (q *Query) isLogsQuery() bool {
+	return q.QueryType == QueryTypeInstant || q.QueryType == ""
+}
+
+// isLogsVolume returns true if the query is the logs volume query of Explore
+func (q *Query) isLogsVolume() bool {
+	return q.SupportingQueryType == SupportingQueryTypeLogsVolume
+}
+
+// isForward returns true if the oldest log lines must be returned first
+func (q *Query) isForward() bool {
+	return q.Direction == QueryDirectionForward
+}
+
+// validateStep checks that the step is empty or a positive duration
+func validateStep(step string) error {
+	if step == "" {
+		return nil
+	}
+	d, err := utils.ParseDuration(step)
+	if err != nil {
+		return fmt.Errorf("failed to parse step %q: %w", step, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("step must be positive; got %q", step)
+	}
+	return nil
 }
 
 // GetQueryURL calculates step and clear expression from template variables,
@@ -73,6 +209,7 @@ func (q *Query) getQueryURL(rawURL string, queryParams string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to parse query params: %s", err.Error())
 	}
+	q.extraFilters.setParams(params)
 
 	q.url = u
 
@@ -91,6 +228,14 @@ func (q *Query) getQueryURL(rawURL string, queryParams string) (string, error) {
 			return "", fmt.Errorf("failed to calculate minimal interval: %w", err)
 		}
 		return q.histQueryURL(params, minInterval), nil
+	case QueryTypeStreams:
+		return q.valuesQueryURL(params, streamsPath), nil
+	case QueryTypeStreamIDs:
+		return q.valuesQueryURL(params, streamIDsQueryPath), nil
+	case QueryTypeFieldNames:
+		return q.valuesQueryURL(params, fieldNamesPath), nil
+	case QueryTypeFieldValues:
+		return q.valuesQueryURL(params, fieldValuesPath), nil
 	default:
 		return q.queryInstantURL(params), nil
 	}
@@ -109,6 +254,7 @@ func (q *Query) queryTailURL(rawURL string, queryParams string) (string, error)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse query params: %s", err.Error())
 	}
+	q.extraFilters.setParams(params)
 
 	q.url = u
 
@@ -152,10 +298,22 @@ func (q *Query) queryInstantURL(queryParams url.Values) string {
 	}
 
 	q.Expr = utils.ReplaceTemplateVariable(q.Expr, q.IntervalMs, q.TimeRange)
-	values.Set("query", q.Expr)
+	expr := q.Expr
+	if q.isForward() {
+		// VictoriaLogs returns the most recent lines for the limit,
+		// so the oldest lines must be selected explicitly
+		expr = fmt.Sprintf("%s | sort by (%s) limit %d", expr, timeField, q.MaxLines)
+	}
+	values.Set("query", expr)
 	values.Set("limit", strconv.Itoa(q.MaxLines))
-	values.Set("start", strconv.FormatInt(q.TimeRange.From.Unix(), 10))
-	values.Set("end", strconv.FormatInt(q.TimeRange.To.Unix(), 10))
+	if q.cursor != nil {
+		// the boundary of the cursor requires nanosecond precision
+		values.Set("start", q.TimeRange.From.UTC().Format(time.RFC3339Nano))
+		values.Set("end", q.TimeRange.To.UTC().Format(time.RFC3339Nano))
+	} else {
+		values.Set("start", strconv.FormatInt(q.TimeRange.From.Unix(), 10))
+		values.Set("end", strconv.FormatInt(q.TimeRange.To.Unix(), 10))
+	}
 
 	q.url.RawQuery = values.Encode()
 	return q.url.String()
@@ -210,12 +368,15 @@ func (q *Query) statsQueryRangeURL(queryParams url.Values, minInterval time.Dura
 		q.TimeRange.To = now
 	}
 
-	q.Expr = utils.ReplaceTemplateVariable(q.Expr, q.IntervalMs, q.TimeRange)
-
 	step := q.Step
 	if step == "" {
 		step = utils.CalculateStep(minInterval, q.TimeRange, q.MaxDataPoints).String()
 	}
+	if q.alignToStep {
+		q.TimeRange = alignTimeRange(q.TimeRange, step)
+	}
+
+	q.Expr = utils.ReplaceTemplateVariable(q.Expr, q.IntervalMs, q.TimeRange)
 
 	values.Set("query", q.Expr)
 	values.Set("start", strconv.FormatInt(q.TimeRange.From.Unix(), 10))
@@ -245,12 +406,15 @@ func (q *Query) histQueryURL(queryParams url.Values, minInterval time.Duration)
 		q.TimeRange.To = now
 	}
 
-	q.Expr = utils.ReplaceTemplateVariable(q.Expr, q.IntervalMs, q.TimeRange)
-
 	step := q.Step
 	if step == "" {
 		step = utils.CalculateStep(minInterval, q.TimeRange, q.MaxDataPoints).String()
 	}
+	if q.alignToStep {
+		q.TimeRange = alignTimeRange(q.TimeRange, step)
+	}
+
+	q.Expr = utils.ReplaceTemplateVariable(q.Expr, q.IntervalMs, q.TimeRange)
 
 	values.Set("query", q.Expr)
 	values.Set("start", strconv.FormatInt(q.TimeRange.From.Unix(), 10))
@@ -262,6 +426,46 @@ func (q *Query) histQueryURL(queryParams url.Values, minInterval time.Duration)
 	return q.url.String()
 }
 
+// valuesQueryURL prepare query url for the endpoints returning values with hits, like streams or field values.
+// All logs of the time range are selected if the expression is empty.
+func (q *Query) valuesQueryURL(queryParams url.Values, endpoint string) string {
+	q.url.Path = path.Join(q.url.Path, endpoint)
+	values := q.url.Query()
+
+	for k, vl := range queryParams {
+		for _, v := range vl {
+			values.Add(k, v)
+		}
+	}
+
+	now := time.Now()
+	if q.TimeRange.From.IsZero() {
+		q.TimeRange.From = now.Add(-time.Minute * 5)
+	}
+	if q.TimeRange.To.IsZero() {
+		q.TimeRange.To = now
+	}
+
+	q.Expr = utils.ReplaceTemplateVariable(q.Expr, q.IntervalMs, q.TimeRange)
+	expr := q.Expr
+	if strings.TrimSpace(expr) == "" {
+		expr = "*"
+	}
+
+	values.Set("query", expr)
+	values.Set("start", strconv.FormatInt(q.TimeRange.From.Unix(), 10))
+	values.Set("end", strconv.FormatInt(q.TimeRange.To.Unix(), 10))
+	if q.MaxLines > 0 {
+		values.Set("limit", strconv.Itoa(q.MaxLines))
+	}
+	if q.QueryType == QueryTypeFieldValues {
+		values.Set("field", q.Field)
+	}
+
+	q.url.RawQuery = values.Encode()
+	return q.url.String()
+}
+
 func (q *Query) addMetadataToMultiFrame(frame *data.Frame) {
 	if len(frame.Fields) < 2 {
 		return
@@ -335,6 +539,21 @@ func labelsToString(labels data.Labels) string {
 	return fmt.Sprintf("%s{%s}", metricName, lbs)
 }
 
+// alignTimeRange aligns the start of the time range down and the end of the
+// time range up to the step. The time range is returned as is if step is invalid.
+func alignTimeRange(tr backend.TimeRange, step string) backend.TimeRange {
+	d, err := utils.ParseDuration(step)
+	if err != nil || d <= 0 {
+		return tr
+	}
+	from := tr.From.Truncate(d)
+	to := tr.To.Truncate(d)
+	if to.Before(tr.To) {
+		to = to.Add(d)
+	}
+	return backend.TimeRange{From: from, To: to}
+}
+
 // calculateMinInterval tries to calculate interval from requested params
 // in duration representation or return error if
 func (q *Query) calculateMinInterval() (time.Duration, error) {
@@ -1,6 +1,11 @@
 package plugin
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,6 +17,7 @@ func TestQuery_getQueryURL(t *testing.T) {
 		RefID     string
 		Expr      string
 		MaxLines  int
+		Field     string
 		TimeRange backend.TimeRange
 		QueryType QueryType
 	}
@@ -470,6 +476,102 @@ func TestQuery_getQueryURL(t *testing.T) {
 			want:    "http://127.0.0.1:9429/select/logsql/hits?end=1609462800&field=&query=%2A+and+syslog+%7C+stats+by%28type%29+count%28%29&start=1609459200&step=15s",
 			wantErr: false,
 		},
+		{
+			name: "streams query without expr",
+			fields: fields{
+				RefID:    "1",
+				Expr:     "",
+				MaxLines: 0,
+				TimeRange: backend.TimeRange{
+					From: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					To:   time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC),
+				},
+				QueryType: QueryTypeStreams,
+			},
+			args: args{
+				rawURL:      "http://127.0.0.1:9429",
+				queryParams: "",
+			},
+			want:    "http://127.0.0.1:9429/select/logsql/streams?end=1609462800&query=%2A&start=1609459200",
+			wantErr: false,
+		},
+		{
+			name: "streams query with limit and params",
+			fields: fields{
+				RefID:    "1",
+				Expr:     "error",
+				MaxLines: 10,
+				TimeRange: backend.TimeRange{
+					From: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					To:   time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC),
+				},
+				QueryType: QueryTypeStreams,
+			},
+			args: args{
+				rawURL:      "http://127.0.0.1:9429",
+				queryParams: "timeout=10s",
+			},
+			want:    "http://127.0.0.1:9429/select/logsql/streams?end=1609462800&limit=10&query=error&start=1609459200&timeout=10s",
+			wantErr: false,
+		},
+		{
+			name: "stream ids query",
+			fields: fields{
+				RefID:    "1",
+				Expr:     "{app=\"nginx\"}",
+				MaxLines: 5,
+				TimeRange: backend.TimeRange{
+					From: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					To:   time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC),
+				},
+				QueryType: QueryTypeStreamIDs,
+			},
+			args: args{
+				rawURL:      "http://127.0.0.1:9429",
+				queryParams: "",
+			},
+			want:    "http://127.0.0.1:9429/select/logsql/stream_ids?end=1609462800&limit=5&query=%7Bapp%3D%22nginx%22%7D&start=1609459200",
+			wantErr: false,
+		},
+		{
+			name: "field names query",
+			fields: fields{
+				RefID:    "1",
+				Expr:     "error",
+				MaxLines: 0,
+				TimeRange: backend.TimeRange{
+					From: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					To:   time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC),
+				},
+				QueryType: QueryTypeFieldNames,
+			},
+			args: args{
+				rawURL:      "http://127.0.0.1:9429",
+				queryParams: "",
+			},
+			want:    "http://127.0.0.1:9429/select/logsql/field_names?end=1609462800&query=error&start=1609459200",
+			wantErr: false,
+		},
+		{
+			name: "field values query",
+			fields: fields{
+				RefID:    "1",
+				Expr:     "",
+				MaxLines: 20,
+				Field:    "level",
+				TimeRange: backend.TimeRange{
+					From: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					To:   time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC),
+				},
+				QueryType: QueryTypeFieldValues,
+			},
+			args: args{
+				rawURL:      "http://127.0.0.1:9429",
+				queryParams: "",
+			},
+			want:    "http://127.0.0.1:9429/select/logsql/field_values?end=1609462800&field=level&limit=20&query=%2A&start=1609459200",
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -480,6 +582,7 @@ func TestQuery_getQueryURL(t *testing.T) {
 				},
 				Expr:     tt.fields.Expr,
 				MaxLines: tt.fields.MaxLines,
+				Field:    tt.fields.Field,
 
 				QueryType: tt.fields.QueryType,
 			}
@@ -610,3 +713,112 @@ func TestQuery_queryTailURL(t *testing.T) {
 		})
 	}
 }
+
+func Test_alignTimeRange(t *testing.T) {
+	f := func(tr backend.TimeRange, step string, want backend.TimeRange) {
+		t.Helper()
+		got := alignTimeRange(tr, step)
+		if !got.From.Equal(want.From) || !got.To.Equal(want.To) {
+			t.Fatalf("expected %v; got %v", want, got)
+		}
+	}
+
+	ts := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tr := backend.TimeRange{From: ts.Add(17 * time.Second), To: ts.Add(5*time.Minute + 3*time.Second)}
+	f(tr, "1m", backend.TimeRange{From: ts, To: ts.Add(6 * time.Minute)})
+	f(backend.TimeRange{From: ts, To: ts.Add(time.Minute)}, "30s", backend.TimeRange{From: ts, To: ts.Add(time.Minute)})
+	// invalid step
+	f(tr, "$__interval", tr)
+	f(tr, "0s", tr)
+}
+
+func TestQuery_validate(t *testing.T) {
+	f := func(q Query, wantErr string) {
+		t.Helper()
+		err := q.validate()
+		if wantErr == "" {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			return
+		}
+		if err == nil || err.Error() != wantErr {
+			t.Fatalf("expected error %q; got %v", wantErr, err)
+		}
+	}
+
+	f(Query{QueryType: QueryTypeInstant}, "")
+	f(Query{}, "")
+	f(Query{QueryType: QueryTypeStats, Expr: "* | stats count()"}, "")
+	f(Query{QueryType: QueryTypeStats, Expr: " "}, "expr can't be empty for stats query")
+	f(Query{QueryType: QueryTypeStatsRange, Expr: "* | stats count()", Step: "1m"}, "")
+	f(Query{QueryType: QueryTypeStatsRange}, "expr can't be empty for statsRange query")
+	f(Query{QueryType: QueryTypeStatsRange, Expr: "*", Step: "abc"}, `failed to parse step "abc": cannot parse duration "abc"`)
+	f(Query{QueryType: QueryTypeHits, Field: "level"}, "")
+	f(Query{QueryType: QueryTypeHits}, "field can't be empty for hits query")
+	f(Query{QueryType: QueryTypeHits, Field: "level", Step: "0s"}, `step must be positive; got "0s"`)
+	f(Query{QueryType: QueryTypeStreams}, "")
+	f(Query{QueryType: QueryTypeStreamIDs, Expr: "error"}, "")
+	f(Query{QueryType: QueryTypeFieldNames}, "")
+	f(Query{QueryType: QueryTypeFieldValues, Field: "level"}, "")
+	f(Query{QueryType: QueryTypeFieldValues}, "field can't be empty for fieldValues query")
+	f(Query{QueryType: QueryTypeInstant, Direction: QueryDirectionForward}, "")
+	f(Query{QueryType: QueryTypeInstant, Direction: "up"}, `unsupported direction "up"; supported directions: backward, forward`)
+	f(Query{QueryType: QueryTypeInstant, Format: QueryFormatAnnotations}, "")
+	f(Query{QueryType: QueryTypeInstant, Format: QueryFormatTable}, "")
+	f(Query{QueryType: QueryTypeInstant, Format: "csv"}, `unsupported format "csv"; supported formats: logs, annotations, table`)
+}
+
+func TestDatasource_queryDirection(t *testing.T) {
+	var mu sync.Mutex
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotQuery = r.FormValue("query")
+		mu.Unlock()
+		// VictoriaLogs doesn't sort log lines
+		for _, ts := range []string{"2024-01-01T00:00:02Z", "2024-01-01T00:00:03Z", "2024-01-01T00:00:01Z"} {
+			_, _ = fmt.Fprintf(w, `{"_msg":"%s","_time":"%s"}`+"\n", ts, ts)
+		}
+	}))
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{URL: srv.URL, JSONData: []byte(`{}`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	f := func(direction QueryDirection, wantQuery string, wantLines ...string) {
+		t.Helper()
+		q := &Query{
+			DataQuery: backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: time.Unix(0, 0), To: time.Unix(1e9, 0)}},
+			Expr:      "error",
+			MaxLines:  10,
+			QueryType: QueryTypeInstant,
+			Direction: direction,
+		}
+		rsp := ds.query(context.Background(), q)
+		if rsp.Error != nil {
+			t.Fatalf("unexpected error: %s", rsp.Error)
+		}
+		mu.Lock()
+		if gotQuery != wantQuery {
+			t.Fatalf("unexpected query; got %q; want %q", gotQuery, wantQuery)
+		}
+		mu.Unlock()
+		frame := rsp.Frames[0]
+		if frame.Rows() != len(wantLines) {
+			t.Fatalf("expected %d lines; got %d", len(wantLines), frame.Rows())
+		}
+		for i, want := range wantLines {
+			if got := frame.Fields[1].At(i); got != want {
+				t.Fatalf("line #%d: got %q; want %q", i, got, want)
+			}
+		}
+	}
+	f("", "error", "2024-01-01T00:00:03Z", "2024-01-01T00:00:02Z", "2024-01-01T00:00:01Z")
+	f(QueryDirectionBackward, "error", "2024-01-01T00:00:03Z", "2024-01-01T00:00:02Z", "2024-01-01T00:00:01Z")
+	// the oldest lines are requested for the forward direction
+	f(QueryDirectionForward, "error | sort by (_time) limit 10", "2024-01-01T00:00:01Z", "2024-01-01T00:00:02Z", "2024-01-01T00:00:03Z")
+}
@@ -0,0 +1,188 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	fieldNamesPath        = "/select/logsql/field_names"
+	fieldValuesPath       = "/select/logsql/field_values"
+	streamsPath           = "/select/logsql/streams"
+	streamFieldNamesPath  = "/select/logsql/stream_field_names"
+	streamFieldValuesPath = "/select/logsql/stream_field_values"
+)
+
+// resourcePaths contains the VictoriaLogs endpoints
+// which can be requested via CallResource
+var resourcePaths = map[string]struct{}{
+	fieldNamesPath:        {},
+	fieldValuesPath:       {},
+	streamsPath:           {},
+	streamFieldNamesPath:  {},
+	streamFieldValuesPath: {},
+}
+
+// CallResource handles the resource requests from the frontend, like
+// field names and field values requests used by autocomplete and variables.
+// The request is sent to the datasource in the same way as data queries,
+// so custom headers, custom query params and retries are applied to it.
+func (d *Datasource) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	resourcePath := "/" + strings.Trim(req.Path, "/")
+	if _, ok := resourcePaths[resourcePath]; !ok {
+		return sendResourceError(sender, http.StatusNotFound, fmt.Errorf("unsupported resource path %q", req.Path))
+	}
+
+	params, err := parseResourceParams(req)
+	if err != nil {
+		return sendResourceError(sender, http.StatusBadRequest, err)
+	}
+
+	tenant, err := d.grafanaSettings.userTenant(req.PluginContext)
+	if err != nil {
+		return sendResourceError(sender, http.StatusForbidden, err)
+	}
+	extraFilters, err := d.grafanaSettings.extraFilters(req.PluginContext)
+	if err != nil {
+		return sendResourceError(sender, http.StatusForbidden, err)
+	}
+	extraFilters.setParams(params)
+	identity, err := d.grafanaSettings.userIdentity(req.PluginContext)
+	if err != nil {
+		return sendResourceError(sender, http.StatusInternalServerError, err)
+	}
+
+	reqURL, err := getResourceURL(d.settings.URL, resourcePath, params, d.grafanaSettings.QueryParams)
+	if err != nil {
+		return sendResourceError(sender, http.StatusBadRequest, fmt.Errorf("failed to create request URL: %w", err))
+	}
+
+	r, err := d.sendRequest(ctx, reqURL, d.requestHeaders(tenant, identity, d.grafanaSettings.headerFilter.filter(req.GetHTTPHeaders())), false)
+	if err != nil {
+		var se *responseStatusError
+		if errors.As(err, &se) {
+			// pass the response of the datasource as is, so the frontend
+			// shows the original error, like invalid LogsQL filter
+			log.DefaultLogger.Error("resource request failed", "err", err.Error())
+			return sender.Send(&backend.CallResourceResponse{
+				Status: se.statusCode,
+				Headers: map[string][]string{
+					"Content-Type": {"text/plain; charset=utf-8"},
+				},
+				Body: []byte(se.body),
+			})
+		}
+		status, _ := classifyError(err)
+		return sendResourceError(sender, int(status), err)
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			log.DefaultLogger.Error("failed to close response body", "err", err.Error())
+		}
+	}()
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return sendResourceError(sender, http.StatusBadGateway, fmt.Errorf("failed to read response body: %w", err))
+	}
+
+	return sender.Send(&backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Headers: map[string][]string{
+			"Content-Type": {"application/json"},
+		},
+		Body: body,
+	})
+}
+
+// parseResourceParams collects query params from the request url
+// and from the form encoded body of the request
+func parseResourceParams(req *backend.CallResourceRequest) (url.Values, error) {
+	params := url.Values{}
+	if req.URL != "" {
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse request url: %w", err)
+		}
+		for k, vl := range u.Query() {
+			for _, v := range vl {
+				params.Add(k, v)
+			}
+		}
+	}
+
+	if len(req.Body) > 0 {
+		bodyParams, err := url.ParseQuery(string(req.Body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse request body: %w", err)
+		}
+		for k, vl := range bodyParams {
+			for _, v := range vl {
+				params.Add(k, v)
+			}
+		}
+	}
+	return params, nil
+}
+
+// getResourceURL builds the datasource url for the resource request.
+// Custom query params are added only if they are not defined in the request,
+// the same way as it works on the frontend side
+func getResourceURL(rawURL, resourcePath string, params url.Values, queryParams string) (string, error) {
+	if rawURL == "" {
+		return "", fmt.Errorf("url can't be blank")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse datasource url: %s", err)
+	}
+	customParams, err := url.ParseQuery(queryParams)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse query params: %s", err.Error())
+	}
+
+	u.Path = path.Join(u.Path, resourcePath)
+	values := u.Query()
+	for k, vl := range params {
+		for _, v := range vl {
+			values.Add(k, v)
+		}
+	}
+	for k, vl := range customParams {
+		if values.Has(k) {
+			continue
+		}
+		for _, v := range vl {
+			values.Add(k, v)
+		}
+	}
+
+	u.RawQuery = values.Encode()
+	return u.String(), nil
+}
+
+// sendResourceError sends the error to the frontend in json format
+func sendResourceError(sender backend.CallResourceResponseSender, status int, err error) error {
+	log.DefaultLogger.Error("resource request failed", "err", err.Error())
+	body, mErr := json.Marshal(map[string]string{"error": err.Error()})
+	if mErr != nil {
+		return mErr
+	}
+	return sender.Send(&backend.CallResourceResponse{
+		Status: status,
+		Headers: map[string][]string{
+			"Content-Type": {"application/json"},
+		},
+		Body: body,
+	})
+}
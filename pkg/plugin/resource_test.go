@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestDatasource_CallResource(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("should not be called: %s", r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/select/logsql/field_names", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("AccountID") != "12" {
+			t.Errorf("expected AccountID header to be set; got %q", r.Header.Get("AccountID"))
+		}
+		if got := r.URL.Query().Get("query"); got != "error" {
+			t.Errorf("expected query param %q; got %q", "error", got)
+		}
+		if got := r.URL.Query().Get("extra_filters"); got != "{job=\"a\"}" {
+			t.Errorf("expected custom query param; got %q", got)
+		}
+		_, _ = w.Write([]byte(`{"values":[{"value":"_msg","hits":10}]}`))
+	})
+	mux.HandleFunc("/select/logsql/field_values", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("field"); got != "job" {
+			t.Errorf("expected field param %q; got %q", "job", got)
+		}
+		if got := r.URL.Query()["limit"]; len(got) != 1 || got[0] != "5" {
+			t.Errorf("expected single limit param; got %q", got)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("cannot parse query [foo(]: unexpected token"))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL:                     srv.URL,
+		JSONData:                []byte(`{"httpMethod":"POST","customQueryParameters":"limit=10&extra_filters={job=\"a\"}","httpHeaderName1":"AccountID"}`),
+		DecryptedSecureJSONData: map[string]string{"httpHeaderValue1": "12"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	f := func(req *backend.CallResourceRequest, wantStatus int, wantBody string) {
+		t.Helper()
+		var got *backend.CallResourceResponse
+		sender := backend.CallResourceResponseSenderFunc(func(resp *backend.CallResourceResponse) error {
+			got = resp
+			return nil
+		})
+		if err := ds.CallResource(context.Background(), req, sender); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got == nil {
+			t.Fatalf("expected response to be sent")
+		}
+		if got.Status != wantStatus {
+			t.Fatalf("expected status %d; got %d", wantStatus, got.Status)
+		}
+		if !strings.Contains(string(got.Body), wantBody) {
+			t.Fatalf("expected body to contain %q; got %q", wantBody, string(got.Body))
+		}
+	}
+
+	// field names with params in the body
+	f(&backend.CallResourceRequest{
+		Path:   "select/logsql/field_names",
+		URL:    "select/logsql/field_names",
+		Method: http.MethodPost,
+		Body:   []byte("query=error&start=1&end=2"),
+	}, http.StatusOK, `{"values":[{"value":"_msg","hits":10}]}`)
+
+	// field values with params in the url, limit must not be overridden by custom params
+	f(&backend.CallResourceRequest{
+		Path:   "select/logsql/field_values",
+		URL:    "select/logsql/field_values?field=job&limit=5",
+		Method: http.MethodGet,
+	}, http.StatusBadRequest, "cannot parse query [foo(]: unexpected token")
+
+	// unsupported path
+	f(&backend.CallResourceRequest{
+		Path:   "select/logsql/delete",
+		URL:    "select/logsql/delete",
+		Method: http.MethodGet,
+	}, http.StatusNotFound, "unsupported resource path")
+
+	// invalid body
+	f(&backend.CallResourceRequest{
+		Path:   "select/logsql/streams",
+		URL:    "select/logsql/streams",
+		Method: http.MethodPost,
+		Body:   []byte("query=%zz"),
+	}, http.StatusBadRequest, "failed to parse request body")
+}
@@ -3,10 +3,12 @@ package plugin
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"time"
 
@@ -30,12 +32,20 @@ const (
 	gLineField   = "Line"
 	gValueField  = "Value"
 
+	gDetectedLevelField = "detected_level"
+
+	// Grafana table fields
+	gStreamField     = "stream"
+	gStreamIDField   = "stream_id"
+	gTableValueField = "value"
+	gHitsField       = "hits"
+
 	logsVisualisation = "logs"
 )
 
 // parseStreamResponse reads data from the reader and collects
 // fields and frame with necessary information
-func parseInstantResponse(reader io.Reader) backend.DataResponse {
+func parseInstantResponse(reader io.Reader, lines lineCounters, opts logsParseOptions) backend.DataResponse {
 
 	labelsField := data.NewFieldFromFieldType(data.FieldTypeJSON, 0)
 	labelsField.Name = gLabelsField
@@ -46,6 +56,12 @@ func parseInstantResponse(reader io.Reader) backend.DataResponse {
 	lineField := data.NewFieldFromFieldType(data.FieldTypeString, 0)
 	lineField.Name = gLineField
 
+	var levelFd *data.Field
+	if opts.levels != nil {
+		levelFd = data.NewFieldFromFieldType(data.FieldTypeString, 0)
+		levelFd.Name = gDetectedLevelField
+	}
+
 	br := bufio.NewReaderSize(reader, 64*1024)
 	var parser fastjson.Parser
 	var finishedReading bool
@@ -54,6 +70,7 @@ func parseInstantResponse(reader io.Reader) backend.DataResponse {
 		if err != nil {
 			if errors.Is(err, bufio.ErrBufferFull) {
 				backend.Logger.Debug("skipping line number #%d: line too long", n)
+				lines.skipped.Inc()
 				continue
 			}
 			if errors.Is(err, io.EOF) {
@@ -73,14 +90,16 @@ func parseInstantResponse(reader io.Reader) backend.DataResponse {
 		if err != nil {
 			return newResponseError(fmt.Errorf("error decode response: %s", err), backend.StatusInternal)
 		}
+		lines.parsed.Inc()
 
-		if value.Exists(messageField) {
-			message := value.GetStringBytes(messageField)
-			lineField.Append(string(message))
+		var message string
+		if v := value.Get(messageField); v != nil {
+			message = logFieldValue(v)
+			lineField.Append(message)
 		}
 		if value.Exists(timeField) {
 			t := value.GetStringBytes(timeField)
-			getTime, err := utils.GetTime(string(t))
+			getTime, err := parseLogTime(string(t))
 			if err != nil {
 				return newResponseError(fmt.Errorf("error parse time from _time field: %s", err), backend.StatusInternal)
 			}
@@ -90,39 +109,25 @@ func parseInstantResponse(reader io.Reader) backend.DataResponse {
 		labels := data.Labels{}
 		if value.Exists(streamField) {
 			stream := value.GetStringBytes(streamField)
-			expr, err := metricsql.Parse(string(stream))
-			if err != nil {
+			if err := parseStreamLabels(string(stream), labels); err != nil {
 				return newResponseError(err, backend.StatusInternal)
 			}
-			if mExpr, ok := expr.(*metricsql.MetricExpr); ok {
-				for _, filters := range mExpr.LabelFilterss {
-					for _, filter := range filters {
-						labels[filter.Label] = filter.Value
-					}
-				}
-			}
 		}
 
 		obj, err := value.Object()
 		if err != nil {
 			return newResponseError(fmt.Errorf("error get object from decoded response: %s", err), backend.StatusInternal)
 		}
-		obj.Visit(func(key []byte, v *fastjson.Value) {
-			if bytes.Equal(key, []byte(timeField)) ||
-				bytes.Equal(key, []byte(streamField)) ||
-				bytes.Equal(key, []byte(messageField)) {
-				return
-			}
-			fieldName := string(key)
-			value := string(v.GetStringBytes())
-			labels[fieldName] = value
-		})
+		visitLogFields(obj, "", labels, opts.flattenFields)
 
 		d, err := labelsToJSON(labels)
 		if err != nil {
 			return newResponseError(err, backend.StatusInternal)
 		}
 		labelsField.Append(d)
+		if levelFd != nil {
+			levelFd.Append(opts.levels.detect(labels, message))
+		}
 	}
 
 	// Grafana expects lineFields to be always non-empty.
@@ -141,7 +146,11 @@ func parseInstantResponse(reader io.Reader) backend.DataResponse {
 		}
 	}
 
-	frame := data.NewFrame("", timeFd, lineField, labelsField)
+	fields := []*data.Field{timeFd, lineField, labelsField}
+	if levelFd != nil {
+		fields = append(fields, levelFd)
+	}
+	frame := data.NewFrame("", fields...)
 
 	rsp := backend.DataResponse{}
 	frame.Meta = &data.FrameMeta{}
@@ -154,7 +163,7 @@ func parseInstantResponse(reader io.Reader) backend.DataResponse {
 // fields and frame with necessary information
 // it looks like the parseInstantResponse function, but it reads data and continuously
 // parse the lines from the reader and we need to collect only one data.Frame
-func parseStreamResponse(reader io.Reader, ch chan *data.Frame) error {
+func parseStreamResponse(reader io.Reader, ch chan *data.Frame, lines lineCounters, opts logsParseOptions) error {
 
 	br := bufio.NewReaderSize(reader, 64*1024)
 	var parser fastjson.Parser
@@ -173,6 +182,7 @@ func parseStreamResponse(reader io.Reader, ch chan *data.Frame) error {
 		if err != nil {
 			if errors.Is(err, bufio.ErrBufferFull) {
 				backend.Logger.Debug("skipping line number #%d: line too long", n)
+				lines.skipped.Inc()
 				continue
 			}
 			if errors.Is(err, io.EOF) {
@@ -192,10 +202,12 @@ func parseStreamResponse(reader io.Reader, ch chan *data.Frame) error {
 		if err != nil {
 			return fmt.Errorf("error decode response: %s", err)
 		}
+		lines.parsed.Inc()
 
-		if value.Exists(messageField) {
-			message := value.GetStringBytes(messageField)
-			lineField.Append(string(message))
+		var message string
+		if v := value.Get(messageField); v != nil {
+			message = logFieldValue(v)
+			lineField.Append(message)
 		}
 		if value.Exists(timeField) {
 			t := value.GetStringBytes(timeField)
@@ -209,33 +221,16 @@ func parseStreamResponse(reader io.Reader, ch chan *data.Frame) error {
 		labels := data.Labels{}
 		if value.Exists(streamField) {
 			stream := value.GetStringBytes(streamField)
-			expr, err := metricsql.Parse(string(stream))
-			if err != nil {
+			if err := parseStreamLabels(string(stream), labels); err != nil {
 				return err
 			}
-			if mExpr, ok := expr.(*metricsql.MetricExpr); ok {
-				for _, filters := range mExpr.LabelFilterss {
-					for _, filter := range filters {
-						labels[filter.Label] = filter.Value
-					}
-				}
-			}
 		}
 
 		obj, err := value.Object()
 		if err != nil {
 			return fmt.Errorf("error get object from decoded response: %s", err)
 		}
-		obj.Visit(func(key []byte, v *fastjson.Value) {
-			if bytes.Equal(key, []byte(timeField)) ||
-				bytes.Equal(key, []byte(streamField)) ||
-				bytes.Equal(key, []byte(messageField)) {
-				return
-			}
-			fieldName := string(key)
-			value := string(v.GetStringBytes())
-			labels[fieldName] = value
-		})
+		visitLogFields(obj, "", labels, opts.flattenFields)
 
 		d, err := labelsToJSON(labels)
 		if err != nil {
@@ -259,7 +254,14 @@ func parseStreamResponse(reader io.Reader, ch chan *data.Frame) error {
 			}
 		}
 
-		frame := data.NewFrame("", timeFd, lineField, labelsField)
+		fields := []*data.Field{timeFd, lineField, labelsField}
+		if opts.levels != nil {
+			levelFd := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+			levelFd.Name = gDetectedLevelField
+			levelFd.Append(opts.levels.detect(labels, message))
+			fields = append(fields, levelFd)
+		}
+		frame := data.NewFrame("", fields...)
 		// this is necessary information because the logs visualization is preferred
 		frame.Meta = &data.FrameMeta{PreferredVisualization: logsVisualisation}
 
@@ -269,7 +271,7 @@ func parseStreamResponse(reader io.Reader, ch chan *data.Frame) error {
 	return nil
 }
 
-func parseStatsResponse(reader io.Reader, q *Query) backend.DataResponse {
+func parseStatsResponse(ctx context.Context, reader io.Reader, q *Query) backend.DataResponse {
 	var rs Response
 	if err := json.NewDecoder(reader).Decode(&rs); err != nil {
 		err = fmt.Errorf("failed to decode body response: %w", err)
@@ -277,7 +279,9 @@ func parseStatsResponse(reader io.Reader, q *Query) backend.DataResponse {
 	}
 	rs.ForAlerting = q.ForAlerting
 
+	_, span := startSpan(ctx, "victorialogs.get_data_frames")
 	frames, err := rs.getDataFrames()
+	span.End()
 	if err != nil {
 		err = fmt.Errorf("failed to prepare data from response: %w", err)
 		return newResponseError(err, backend.StatusInternal)
@@ -290,14 +294,16 @@ func parseStatsResponse(reader io.Reader, q *Query) backend.DataResponse {
 	return backend.DataResponse{Frames: frames}
 }
 
-func parseHitsResponse(reader io.Reader) backend.DataResponse {
+func parseHitsResponse(ctx context.Context, reader io.Reader) backend.DataResponse {
 	var hr HitsResponse
 	if err := json.NewDecoder(reader).Decode(&hr); err != nil {
 		err = fmt.Errorf("failed to decode body response: %w", err)
 		return newResponseError(err, backend.StatusInternal)
 	}
 
+	_, span := startSpan(ctx, "victorialogs.get_data_frames")
 	frames, err := hr.getDataFrames()
+	span.End()
 	if err != nil {
 		err = fmt.Errorf("failed to prepare data from response: %w", err)
 		return newResponseError(err, backend.StatusInternal)
@@ -306,27 +312,131 @@ func parseHitsResponse(reader io.Reader) backend.DataResponse {
 	return backend.DataResponse{Frames: frames}
 }
 
-// parseErrorResponse reads data from the reader and returns error
-func parseErrorResponse(reader io.Reader) error {
-	var rs Response
-	if err := json.NewDecoder(reader).Decode(&rs); err != nil {
+// parseValuesResponse parses the response of the endpoints returning values with hits
+func parseValuesResponse(ctx context.Context, reader io.Reader, q *Query) backend.DataResponse {
+	var vr ValuesResponse
+	if err := json.NewDecoder(reader).Decode(&vr); err != nil {
 		err = fmt.Errorf("failed to decode body response: %w", err)
-		return err
+		return newResponseError(err, backend.StatusInternal)
 	}
 
-	if rs.Status == "error" {
-		return fmt.Errorf("error: %s", rs.Error)
+	_, span := startSpan(ctx, "victorialogs.get_data_frames")
+	var frame *data.Frame
+	var err error
+	switch q.QueryType {
+	case QueryTypeStreams:
+		frame, err = vr.streamsDataFrame()
+	case QueryTypeStreamIDs:
+		frame = vr.valuesDataFrame(gStreamIDField)
+	default:
+		frame = vr.valuesDataFrame(gTableValueField)
+	}
+	span.End()
+	if err != nil {
+		err = fmt.Errorf("failed to prepare data from response: %w", err)
+		return newResponseError(err, backend.StatusInternal)
 	}
 
-	if rs.Error == "" {
-		return fmt.Errorf("got unexpected error from the datasource")
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// parseErrorResponse reads the error message from the response body.
+// VictoriaLogs responds with plain text errors, but the body can also contain
+// json object with error field if the response was sent by a proxy.
+func parseErrorResponse(reader io.Reader) string {
+	body, err := io.ReadAll(io.LimitReader(reader, maxErrorResponseSize))
+	if err != nil {
+		return fmt.Sprintf("failed to read error response body: %s", err)
 	}
+	body = bytes.TrimSpace(body)
 
+	var rs Response
+	if err := json.Unmarshal(body, &rs); err == nil && rs.Error != "" {
+		return rs.Error
+	}
+	return string(body)
+}
+
+// parseLogTime parses _time field of the log line.
+// VictoriaLogs returns _time in RFC3339 format with nanosecond precision,
+// which must be kept, so lines with close timestamps are sorted and paginated correctly.
+func parseLogTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.UTC(), nil
+	}
+	return utils.GetTime(s)
+}
+
+// parseStreamLabels parses labels of the log stream, e.g. {app="nginx",env="prod"},
+// and adds them to the given labels
+func parseStreamLabels(stream string, labels data.Labels) error {
+	expr, err := metricsql.Parse(stream)
+	if err != nil {
+		return err
+	}
+	if mExpr, ok := expr.(*metricsql.MetricExpr); ok {
+		for _, filters := range mExpr.LabelFilterss {
+			for _, filter := range filters {
+				labels[filter.Label] = filter.Value
+			}
+		}
+	}
 	return nil
 }
 
 // labelsToJSON converts labels to json representation
 // data.Labels when converted to JSON keep the fields sorted
+// logsParseOptions defines how log lines of the response are parsed
+type logsParseOptions struct {
+	// levels detects the level of log lines if it isn't nil
+	levels *levelDetector
+	// flattenFields flattens nested objects into fields with dotted keys
+	flattenFields bool
+}
+
+// logsParseOptions returns options of parsing log lines from the datasource settings
+func (gs *GrafanaSettings) logsParseOptions() logsParseOptions {
+	return logsParseOptions{
+		levels:        gs.levelDetector,
+		flattenFields: gs.FlattenNestedFields,
+	}
+}
+
+// visitLogFields adds fields of the log line except _time, _stream and _msg to labels.
+// Nested objects are flattened into fields with dotted keys if flatten is set,
+// otherwise they are kept as JSON text like other non-string values.
+func visitLogFields(obj *fastjson.Object, prefix string, labels data.Labels, flatten bool) {
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		if prefix == "" && (bytes.Equal(key, []byte(timeField)) ||
+			bytes.Equal(key, []byte(streamField)) ||
+			bytes.Equal(key, []byte(messageField))) {
+			return
+		}
+		fieldName := prefix + string(key)
+		if flatten && v.Type() == fastjson.TypeObject {
+			nested := v.GetObject()
+			if nested.Len() > 0 {
+				visitLogFields(nested, fieldName+".", labels, flatten)
+				return
+			}
+		}
+		labels[fieldName] = logFieldValue(v)
+	})
+}
+
+// logFieldValue returns the value of the log field as a string.
+// Numbers, bools, arrays and objects are returned as JSON text, and null is returned as an empty string.
+func logFieldValue(v *fastjson.Value) string {
+	switch v.Type() {
+	case fastjson.TypeString:
+		return string(v.GetStringBytes())
+	case fastjson.TypeNull:
+		return ""
+	default:
+		return string(v.MarshalTo(nil))
+	}
+}
+
 func labelsToJSON(labels data.Labels) (json.RawMessage, error) {
 	b, err := json.Marshal(labels)
 	if err != nil {
@@ -519,3 +629,80 @@ func (hr *HitsResponse) getDataFrames() (data.Frames, error) {
 
 	return frames, nil
 }
+
+// ValueHits represents a single value with the number of matching logs
+type ValueHits struct {
+	Value string `json:"value"`
+	Hits  uint64 `json:"hits"`
+}
+
+// ValuesResponse represents response from the endpoints returning values with hits,
+// like streams, stream_ids, field_names and field_values
+type ValuesResponse struct {
+	Values []ValueHits `json:"values"`
+}
+
+// streamsDataFrame returns the table with streams, their labels and hits.
+// Every label of the streams is returned in its own column,
+// the value is empty if the stream doesn't have the label.
+func (vr *ValuesResponse) streamsDataFrame() (*data.Frame, error) {
+	streamLabels := make([]data.Labels, len(vr.Values))
+	names := make(map[string]struct{})
+	for i, v := range vr.Values {
+		labels := data.Labels{}
+		if err := parseStreamLabels(v.Value, labels); err != nil {
+			return nil, fmt.Errorf("cannot parse stream %q: %w", v.Value, err)
+		}
+		for name := range labels {
+			names[name] = struct{}{}
+		}
+		streamLabels[i] = labels
+	}
+	labelNames := make([]string, 0, len(names))
+	for name := range names {
+		labelNames = append(labelNames, name)
+	}
+	sort.Strings(labelNames)
+
+	streamFd := data.NewFieldFromFieldType(data.FieldTypeString, len(vr.Values))
+	streamFd.Name = gStreamField
+	hitsFd := data.NewFieldFromFieldType(data.FieldTypeUint64, len(vr.Values))
+	hitsFd.Name = gHitsField
+	labelFds := make([]*data.Field, len(labelNames))
+	for j, name := range labelNames {
+		labelFds[j] = data.NewFieldFromFieldType(data.FieldTypeString, len(vr.Values))
+		labelFds[j].Name = name
+	}
+
+	for i, v := range vr.Values {
+		streamFd.Set(i, v.Value)
+		hitsFd.Set(i, v.Hits)
+		for j, name := range labelNames {
+			labelFds[j].Set(i, streamLabels[i][name])
+		}
+	}
+
+	fields := make([]*data.Field, 0, len(labelFds)+2)
+	fields = append(fields, streamFd)
+	fields = append(fields, labelFds...)
+	fields = append(fields, hitsFd)
+	frame := data.NewFrame("", fields...)
+	frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+	return frame, nil
+}
+
+// valuesDataFrame returns the table with values and hits
+func (vr *ValuesResponse) valuesDataFrame(name string) *data.Frame {
+	valueFd := data.NewFieldFromFieldType(data.FieldTypeString, len(vr.Values))
+	valueFd.Name = name
+	hitsFd := data.NewFieldFromFieldType(data.FieldTypeUint64, len(vr.Values))
+	hitsFd.Name = gHitsField
+	for i, v := range vr.Values {
+		valueFd.Set(i, v.Value)
+		hitsFd.Set(i, v.Hits)
+	}
+
+	frame := data.NewFrame("", valueFd, hitsFd)
+	frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+	return frame
+}
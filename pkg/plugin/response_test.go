@@ -2,6 +2,8 @@ package plugin
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -366,9 +368,9 @@ func Test_parseStreamResponse(t *testing.T) {
 				lineField := data.NewFieldFromFieldType(data.FieldTypeString, 0)
 				lineField.Name = gLineField
 
-				timeFd.Append(time.Date(2024, 9, 10, 12, 24, 38, 124000000, time.UTC))
-				timeFd.Append(time.Date(2024, 9, 10, 12, 36, 10, 664000000, time.UTC))
-				timeFd.Append(time.Date(2024, 9, 10, 13, 06, 56, 451000000, time.UTC))
+				timeFd.Append(time.Date(2024, 9, 10, 12, 24, 38, 124811000, time.UTC))
+				timeFd.Append(time.Date(2024, 9, 10, 12, 36, 10, 664553169, time.UTC))
+				timeFd.Append(time.Date(2024, 9, 10, 13, 06, 56, 451470000, time.UTC))
 
 				lineField.Append("1")
 
@@ -428,7 +430,7 @@ func Test_parseStreamResponse(t *testing.T) {
 				lineField := data.NewFieldFromFieldType(data.FieldTypeString, 0)
 				lineField.Name = gLineField
 
-				timeFd.Append(time.Date(2024, 9, 10, 12, 36, 10, 664000000, time.UTC))
+				timeFd.Append(time.Date(2024, 9, 10, 12, 36, 10, 664553169, time.UTC))
 
 				// string with more than 1MB
 				str := strings.Repeat("1", 1024*1024*2)
@@ -464,7 +466,7 @@ func Test_parseStreamResponse(t *testing.T) {
 
 			r := io.NopCloser(bytes.NewBuffer(file))
 			w := tt.want()
-			resp := parseInstantResponse(r)
+			resp := parseInstantResponse(r, newLineCounters("test"), logsParseOptions{})
 
 			if w.Error != nil {
 				if !reflect.DeepEqual(w, resp) {
@@ -506,6 +508,57 @@ func Test_parseStreamResponse(t *testing.T) {
 	}
 }
 
+func Test_parseInstantResponse_fieldValues(t *testing.T) {
+	f := func(flatten bool, response string, wantLine string, want data.Labels) {
+		t.Helper()
+		rsp := parseInstantResponse(strings.NewReader(response), newLineCounters("test"), logsParseOptions{flattenFields: flatten})
+		if rsp.Error != nil {
+			t.Fatalf("unexpected error: %s", rsp.Error)
+		}
+		frame := rsp.Frames[0]
+		if line := frame.Fields[1].At(0).(string); line != wantLine {
+			t.Fatalf("unexpected line; got %q; want %q", line, wantLine)
+		}
+		var got data.Labels
+		if err := json.Unmarshal(frame.Fields[2].At(0).(json.RawMessage), &got); err != nil {
+			t.Fatalf("cannot parse labels: %s", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected labels\ngot:  %v\nwant: %v", got, want)
+		}
+	}
+
+	response := `{"_time":"2024-01-01T00:00:00Z","_msg":"done","_stream":"{app=\"api\"}","status":200,"duration":0.25,"cached":true,"user":null,"tags":["a","b"],"http":{"method":"GET","request":{"bytes":512}},"meta":{}}`
+
+	// non-string values are kept as JSON text
+	f(false, response, "done", data.Labels{
+		"app":      "api",
+		"status":   "200",
+		"duration": "0.25",
+		"cached":   "true",
+		"user":     "",
+		"tags":     `["a","b"]`,
+		"http":     `{"method":"GET","request":{"bytes":512}}`,
+		"meta":     `{}`,
+	})
+
+	// nested objects are flattened with dotted keys
+	f(true, response, "done", data.Labels{
+		"app":                "api",
+		"status":             "200",
+		"duration":           "0.25",
+		"cached":             "true",
+		"user":               "",
+		"tags":               `["a","b"]`,
+		"http.method":        "GET",
+		"http.request.bytes": "512",
+		"meta":               `{}`,
+	})
+
+	// the message isn't blanked if it isn't a string
+	f(false, `{"_time":"2024-01-01T00:00:00Z","_msg":{"event":"login"}}`, `{"event":"login"}`, data.Labels{})
+}
+
 func Test_getStatsResponse(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -644,7 +697,7 @@ func Test_getStatsResponse(t *testing.T) {
 
 			r := io.NopCloser(bytes.NewBuffer(file))
 			w := tt.want()
-			resp := parseStatsResponse(r, tt.q)
+			resp := parseStatsResponse(context.Background(), r, tt.q)
 
 			if w.Error != nil {
 				if w.Error.Error() != resp.Error.Error() {
@@ -750,7 +803,7 @@ func Test_parseHitsResponse(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 
 			w := tt.want()
-			resp := parseHitsResponse(tt.reader)
+			resp := parseHitsResponse(context.Background(), tt.reader)
 
 			if w.Error != nil {
 				if w.Error.Error() != resp.Error.Error() {
@@ -775,3 +828,113 @@ func Test_parseHitsResponse(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseValuesResponse(t *testing.T) {
+	f := func(queryType QueryType, body string, want func() backend.DataResponse) {
+		t.Helper()
+		w := want()
+		resp := parseValuesResponse(context.Background(), bytes.NewBufferString(body), &Query{QueryType: queryType})
+		if w.Error != nil {
+			if resp.Error == nil || w.Error.Error() != resp.Error.Error() {
+				t.Fatalf("expected error %q; got %v", w.Error, resp.Error)
+			}
+			return
+		}
+		if resp.Error != nil {
+			t.Fatalf("unexpected error: %s", resp.Error)
+		}
+		got, err := resp.MarshalJSON()
+		if err != nil {
+			t.Fatalf("error marshal response: %s", err)
+		}
+		exp, err := w.MarshalJSON()
+		if err != nil {
+			t.Fatalf("error marshal want response: %s", err)
+		}
+		if !bytes.Equal(got, exp) {
+			t.Fatalf("\n got value: %s, \n want value: %s", got, exp)
+		}
+	}
+
+	// empty streams
+	f(QueryTypeStreams, `{"values":[]}`, func() backend.DataResponse {
+		frame := data.NewFrame("",
+			data.NewField(gStreamField, nil, []string{}),
+			data.NewField(gHitsField, nil, []uint64{}))
+		frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+		return backend.DataResponse{Frames: data.Frames{frame}}
+	})
+
+	// streams with different labels
+	f(QueryTypeStreams, `{"values":[{"value":"{app=\"nginx\",env=\"prod\"}","hits":25},{"value":"{app=\"api\",host=\"h1\"}","hits":3}]}`, func() backend.DataResponse {
+		frame := data.NewFrame("",
+			data.NewField(gStreamField, nil, []string{`{app="nginx",env="prod"}`, `{app="api",host="h1"}`}),
+			data.NewField("app", nil, []string{"nginx", "api"}),
+			data.NewField("env", nil, []string{"prod", ""}),
+			data.NewField("host", nil, []string{"", "h1"}),
+			data.NewField(gHitsField, nil, []uint64{25, 3}))
+		frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+		return backend.DataResponse{Frames: data.Frames{frame}}
+	})
+
+	// stream without labels
+	f(QueryTypeStreams, `{"values":[{"value":"{}","hits":7}]}`, func() backend.DataResponse {
+		frame := data.NewFrame("",
+			data.NewField(gStreamField, nil, []string{"{}"}),
+			data.NewField(gHitsField, nil, []uint64{7}))
+		frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+		return backend.DataResponse{Frames: data.Frames{frame}}
+	})
+
+	// invalid stream
+	f(QueryTypeStreams, `{"values":[{"value":"{app=","hits":1}]}`, func() backend.DataResponse {
+		return newResponseError(fmt.Errorf("failed to prepare data from response: cannot parse stream \"{app=\": StringExpr: unexpected token \"\"; want \"string\"; unparsed data: \"\""), backend.StatusInternal)
+	})
+
+	// stream ids
+	f(QueryTypeStreamIDs, `{"values":[{"value":"0000000000000000a2b37c6d1e8b","hits":12}]}`, func() backend.DataResponse {
+		frame := data.NewFrame("",
+			data.NewField(gStreamIDField, nil, []string{"0000000000000000a2b37c6d1e8b"}),
+			data.NewField(gHitsField, nil, []uint64{12}))
+		frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+		return backend.DataResponse{Frames: data.Frames{frame}}
+	})
+
+	// field names
+	f(QueryTypeFieldNames, `{"values":[{"value":"_msg","hits":120},{"value":"level","hits":80}]}`, func() backend.DataResponse {
+		frame := data.NewFrame("",
+			data.NewField(gTableValueField, nil, []string{"_msg", "level"}),
+			data.NewField(gHitsField, nil, []uint64{120, 80}))
+		frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+		return backend.DataResponse{Frames: data.Frames{frame}}
+	})
+
+	// field values
+	f(QueryTypeFieldValues, `{"values":[{"value":"error","hits":3}]}`, func() backend.DataResponse {
+		frame := data.NewFrame("",
+			data.NewField(gTableValueField, nil, []string{"error"}),
+			data.NewField(gHitsField, nil, []uint64{3}))
+		frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+		return backend.DataResponse{Frames: data.Frames{frame}}
+	})
+
+	// invalid response
+	f(QueryTypeStreamIDs, `{"values":`, func() backend.DataResponse {
+		return newResponseError(fmt.Errorf("failed to decode body response: unexpected EOF"), backend.StatusInternal)
+	})
+}
+
+func Test_parseErrorResponse(t *testing.T) {
+	f := func(body, want string) {
+		t.Helper()
+		got := parseErrorResponse(bytes.NewBufferString(body))
+		if got != want {
+			t.Fatalf("expected %q; got %q", want, got)
+		}
+	}
+
+	f("", "")
+	f("cannot parse query [foo:]: missing value\n", "cannot parse query [foo:]: missing value")
+	f(`{"status":"error","error":"too many requests"}`, "too many requests")
+	f(`{"status":"ok"}`, `{"status":"ok"}`)
+}
@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultRetryPolicy = retryPolicy{
+		maxAttempts:    2,
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     2 * time.Second,
+	}
+	// alerting queries are not interactive, so they can wait longer
+	defaultAlertingRetryPolicy = retryPolicy{
+		maxAttempts:    3,
+		initialBackoff: 500 * time.Millisecond,
+		maxBackoff:     10 * time.Second,
+	}
+)
+
+// RetrySettings contains the retry policy settings
+type RetrySettings struct {
+	// MaxAttempts defines the max number of attempts including the first one
+	MaxAttempts int `json:"maxAttempts"`
+	// InitialBackoff defines the delay before the first retry.
+	// The delay is doubled for every next retry.
+	InitialBackoff string `json:"initialBackoff"`
+	// MaxBackoff defines the max delay between retries
+	MaxBackoff string `json:"maxBackoff"`
+}
+
+// retryPolicy defines how failed requests to the datasource are retried
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// parse returns the retry policy based on settings.
+// Values from defaultPolicy are used for empty settings.
+func (rs RetrySettings) parse(defaultPolicy retryPolicy) (retryPolicy, error) {
+	p := defaultPolicy
+	if rs.MaxAttempts < 0 {
+		return p, fmt.Errorf("max attempts can't be negative; got %d", rs.MaxAttempts)
+	}
+	if rs.MaxAttempts > 0 {
+		p.maxAttempts = rs.MaxAttempts
+	}
+
+	var err error
+	p.initialBackoff, err = parseDurationSetting("initial backoff", rs.InitialBackoff, defaultPolicy.initialBackoff)
+	if err != nil {
+		return p, err
+	}
+	p.maxBackoff, err = parseDurationSetting("max backoff", rs.MaxBackoff, defaultPolicy.maxBackoff)
+	if err != nil {
+		return p, err
+	}
+	if p.maxBackoff < p.initialBackoff {
+		return p, fmt.Errorf("max backoff %s can't be less than initial backoff %s", p.maxBackoff, p.initialBackoff)
+	}
+	return p, nil
+}
+
+// backoff returns the delay before the next attempt. The delay grows exponentially
+// with every attempt up to maxBackoff. Jitter is added to the delay, so clients
+// do not retry at the same time.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.initialBackoff
+	for i := 1; i < attempt && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.maxBackoff)
+	if d <= 0 {
+		return 0
+	}
+	// use the jitter in [d/2, d) range
+	half := d / 2
+	return half + rand.N(d-half)
+}
+
+// isRetryableStatusCode returns true if the request with the given
+// response status code can succeed on the next attempt
+func isRetryableStatusCode(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// isIdempotentRequest returns true if the request can be safely retried.
+// All requests to the select API of VictoriaLogs are read-only,
+// so they are idempotent regardless of the http method.
+func isIdempotentRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return strings.Contains(req.URL.Path, "/select/")
+}
+
+// parseRetryAfter parses the value of Retry-After header, which can contain
+// either the number of seconds or http date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	d := t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// canWaitForRetry checks if the next attempt can be made after the delay
+// requested by the datasource via Retry-After header
+func canWaitForRetry(ctx context.Context, retryAfter time.Duration, p retryPolicy) bool {
+	if retryAfter > p.maxBackoff {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= retryAfter {
+		return false
+	}
+	return true
+}
+
+// sleepWithContext waits for the given duration or until the context is done
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// drainBody reads the rest of the body and closes it,
+// so the connection can be reused
+func drainBody(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, 64*1024))
+	_ = body.Close()
+}
@@ -0,0 +1,161 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := retryPolicy{maxAttempts: 5, initialBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+
+	f := func(attempt int, wantMax time.Duration) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			got := p.backoff(attempt)
+			if got < wantMax/2 || got >= wantMax {
+				t.Fatalf("attempt %d: expected backoff in [%s, %s); got %s", attempt, wantMax/2, wantMax, got)
+			}
+		}
+	}
+
+	f(1, 100*time.Millisecond)
+	f(2, 200*time.Millisecond)
+	f(3, 400*time.Millisecond)
+	f(5, time.Second)
+	f(100, time.Second)
+
+	if got := (retryPolicy{}).backoff(1); got != 0 {
+		t.Fatalf("expected zero backoff; got %s", got)
+	}
+}
+
+func TestRetrySettings_parse(t *testing.T) {
+	f := func(rs RetrySettings, want retryPolicy, wantErr bool) {
+		t.Helper()
+		got, err := rs.parse(defaultRetryPolicy)
+		if (err != nil) != wantErr {
+			t.Fatalf("expected error %v; got %v", wantErr, err)
+		}
+		if !wantErr && got != want {
+			t.Fatalf("expected %+v; got %+v", want, got)
+		}
+	}
+
+	f(RetrySettings{}, defaultRetryPolicy, false)
+	f(RetrySettings{MaxAttempts: 4, InitialBackoff: "1s", MaxBackoff: "1m"}, retryPolicy{
+		maxAttempts:    4,
+		initialBackoff: time.Second,
+		maxBackoff:     time.Minute,
+	}, false)
+	f(RetrySettings{MaxAttempts: -1}, retryPolicy{}, true)
+	f(RetrySettings{InitialBackoff: "abc"}, retryPolicy{}, true)
+	f(RetrySettings{InitialBackoff: "1m", MaxBackoff: "1s"}, retryPolicy{}, true)
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := func(value string, want time.Duration, wantOK bool) {
+		t.Helper()
+		got, ok := parseRetryAfter(value, now)
+		if ok != wantOK || got != want {
+			t.Fatalf("expected %s, %v; got %s, %v", want, wantOK, got, ok)
+		}
+	}
+
+	f("", 0, false)
+	f("abc", 0, false)
+	f("-1", 0, false)
+	f("3", 3*time.Second, true)
+	f("Mon, 01 Jan 2024 00:00:10 GMT", 10*time.Second, true)
+	f("Sun, 31 Dec 2023 23:59:00 GMT", 0, true)
+}
+
+func TestDatasource_doRequestRetries(t *testing.T) {
+	var requests atomic.Int32
+	var failures atomic.Int32
+	var retryAfter atomic.Value
+	retryAfter.Store("0")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		if failures.Add(-1) >= 0 {
+			w.Header().Set("Retry-After", retryAfter.Load().(string))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"_msg":"123","_time":"2024-02-20T14:04:27Z"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL: srv.URL,
+		JSONData: []byte(`{
+			"retryPolicy":{"maxAttempts":2,"initialBackoff":"1ms","maxBackoff":"10ms"},
+			"alertingRetryPolicy":{"maxAttempts":4,"initialBackoff":"1ms","maxBackoff":"10ms"}
+		}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	f := func(failed int32, forAlerting bool, wantRequests int32, wantErr string) {
+		t.Helper()
+		requests.Store(0)
+		failures.Store(failed)
+		q := &Query{
+			DataQuery:   backend.DataQuery{RefID: "A"},
+			Expr:        "*",
+			QueryType:   QueryTypeInstant,
+			ForAlerting: forAlerting,
+		}
+		rsp := ds.query(context.Background(), q)
+		if requests.Load() != wantRequests {
+			t.Fatalf("expected %d requests; got %d", wantRequests, requests.Load())
+		}
+		if wantErr == "" {
+			if rsp.Error != nil {
+				t.Fatalf("unexpected error: %s", rsp.Error)
+			}
+			return
+		}
+		if rsp.Error == nil || !strings.Contains(rsp.Error.Error(), wantErr) {
+			t.Fatalf("expected error %q; got %v", wantErr, rsp.Error)
+		}
+	}
+
+	f(0, false, 1, "")
+	f(1, false, 2, "")
+	f(2, false, 2, "got unexpected response status code: 503")
+	// alerting queries use own retry policy
+	f(3, true, 4, "")
+	f(4, true, 4, "got unexpected response status code: 503")
+
+	// Retry-After exceeding max backoff must not be shortened
+	retryAfter.Store("30")
+	f(1, false, 1, "got unexpected response status code: 503")
+}
+
+func Test_canWaitForRetry(t *testing.T) {
+	p := retryPolicy{maxAttempts: 3, initialBackoff: 100 * time.Millisecond, maxBackoff: 2 * time.Second}
+
+	if !canWaitForRetry(context.Background(), time.Second, p) {
+		t.Fatalf("expected to wait for delay less than max backoff")
+	}
+	if canWaitForRetry(context.Background(), 30*time.Second, p) {
+		t.Fatalf("expected not to wait for delay bigger than max backoff")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if canWaitForRetry(ctx, time.Second, p) {
+		t.Fatalf("expected not to wait for delay exceeding the context deadline")
+	}
+}
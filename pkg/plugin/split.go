@@ -0,0 +1,221 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/VictoriaMetrics/victorialogs-datasource/pkg/utils"
+)
+
+const defaultSplitConcurrency = 4
+
+// shouldSplit checks if the instant query must be split into
+// several queries by the time range
+func (d *Datasource) shouldSplit(q *Query) bool {
+	if d.grafanaSettings.splitInterval <= 0 {
+		return false
+	}
+	if q.QueryType != QueryTypeInstant && q.QueryType != "" {
+		return false
+	}
+	// the empty time range is replaced with the default one by queryInstantURL
+	if q.TimeRange.From.IsZero() || q.TimeRange.To.IsZero() {
+		return false
+	}
+	return q.TimeRange.To.Sub(q.TimeRange.From) > d.grafanaSettings.splitInterval
+}
+
+// splitTimeRange splits the time range into sub ranges with the given interval.
+// Sub ranges are returned from the newest to the oldest one and do not overlap.
+func splitTimeRange(tr backend.TimeRange, interval time.Duration) []backend.TimeRange {
+	if interval <= 0 || !tr.To.After(tr.From) {
+		return []backend.TimeRange{tr}
+	}
+
+	var ranges []backend.TimeRange
+	end := tr.To
+	for end.After(tr.From) {
+		start := end.Add(-interval)
+		if start.Before(tr.From) {
+			start = tr.From
+		}
+		ranges = append(ranges, backend.TimeRange{From: start, To: end})
+		// the end of the next range must not overlap with the start of the current one
+		end = start.Add(-time.Nanosecond)
+	}
+	return ranges
+}
+
+// splitQuery executes the instant query by splitting its time range into
+// sub ranges. Sub queries are executed concurrently in batches. Execution stops
+// as soon as the requested number of lines has been collected.
+func (d *Datasource) splitQuery(ctx context.Context, q *Query) backend.DataResponse {
+	if q.MaxLines <= 0 {
+		q.MaxLines = defaultMaxLines
+	}
+	// template variables must be calculated for the whole time range
+	q.Expr = utils.ReplaceTemplateVariable(q.Expr, q.IntervalMs, q.TimeRange)
+
+	concurrency := d.grafanaSettings.SplitConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultSplitConcurrency
+	}
+
+	ranges := splitTimeRange(q.TimeRange, d.grafanaSettings.splitInterval)
+	if q.isForward() {
+		// the oldest lines are requested first
+		slices.Reverse(ranges)
+	}
+	var frames []*data.Frame
+	var lines int
+	for i := 0; i < len(ranges) && lines < q.MaxLines; i += concurrency {
+		batch := ranges[i:min(i+concurrency, len(ranges))]
+		responses := make([]backend.DataResponse, len(batch))
+
+		var wg sync.WaitGroup
+		for j, tr := range batch {
+			wg.Add(1)
+			go func(j int, tr backend.TimeRange) {
+				defer wg.Done()
+				responses[j] = d.subQuery(ctx, q, tr)
+			}(j, tr)
+		}
+		wg.Wait()
+
+		for _, rsp := range responses {
+			if rsp.Error != nil {
+				return rsp
+			}
+			for _, frame := range rsp.Frames {
+				lines += frame.Rows()
+				frames = append(frames, frame)
+			}
+		}
+	}
+
+	frame, err := mergeLogFrames(frames, q.MaxLines, q.Direction)
+	if err != nil {
+		return newResponseError(err, backend.StatusInternal)
+	}
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// subQuery executes a copy of the instant query for the given time range
+func (d *Datasource) subQuery(ctx context.Context, q *Query, tr backend.TimeRange) backend.DataResponse {
+	sq := *q
+	sq.TimeRange = tr
+
+	reqURL, err := sq.getQueryURL(d.settings.URL, d.grafanaSettings.QueryParams)
+	if err != nil {
+		return newResponseError(fmt.Errorf("failed to create request URL: %w", err), backend.StatusInternal)
+	}
+	reqURL, err = setTimeRangeParams(reqURL, tr)
+	if err != nil {
+		return newResponseError(err, backend.StatusInternal)
+	}
+
+	r, err := d.sendRequest(ctx, reqURL, d.queryHeaders(q), q.ForAlerting)
+	if err != nil {
+		return newRequestErrorResponse(err)
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			log.DefaultLogger.Error("failed to close response body", "err", err.Error())
+		}
+	}()
+
+	return d.parseResponse(ctx, r, q)
+}
+
+// setTimeRangeParams sets start and end params of the url with nanosecond
+// precision, so adjacent sub ranges do not return the same log lines
+func setTimeRangeParams(reqURL string, tr backend.TimeRange) (string, error) {
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse request url: %w", err)
+	}
+	values := u.Query()
+	values.Set("start", tr.From.UTC().Format(time.RFC3339Nano))
+	values.Set("end", tr.To.UTC().Format(time.RFC3339Nano))
+	u.RawQuery = values.Encode()
+	return u.String(), nil
+}
+
+// mergeLogFrames merges log frames with the same schema into the one frame
+// sorted by time in the given direction. The backward direction returns the newest
+// lines first. The result is limited by the given number of lines if it is positive.
+func mergeLogFrames(frames []*data.Frame, limit int, direction QueryDirection) (*data.Frame, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("failed to merge frames: no frames to merge")
+	}
+
+	type row struct {
+		frame int
+		idx   int
+		ts    time.Time
+	}
+	var rows []row
+	for i, frame := range frames {
+		timeIdx := logsTimeFieldIdx(frame)
+		if timeIdx < 0 {
+			return nil, fmt.Errorf("failed to merge frames: frame doesn't contain %q field", gTimeField)
+		}
+		if _, err := frame.RowLen(); err != nil {
+			return nil, fmt.Errorf("failed to merge frames: %w", err)
+		}
+		for j := 0; j < frame.Rows(); j++ {
+			ts, _ := frame.Fields[timeIdx].At(j).(time.Time)
+			rows = append(rows, row{frame: i, idx: j, ts: ts})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if direction == QueryDirectionForward {
+			return rows[i].ts.Before(rows[j].ts)
+		}
+		return rows[i].ts.After(rows[j].ts)
+	})
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	first := frames[0]
+	fields := make([]*data.Field, len(first.Fields))
+	for i, f := range first.Fields {
+		fields[i] = data.NewFieldFromFieldType(f.Type(), len(rows))
+		fields[i].Name = f.Name
+		fields[i].Labels = f.Labels
+		fields[i].Config = f.Config
+	}
+	for i, r := range rows {
+		frame := frames[r.frame]
+		if len(frame.Fields) != len(fields) {
+			return nil, fmt.Errorf("failed to merge frames: different number of fields %d != %d", len(frame.Fields), len(fields))
+		}
+		for j, f := range frame.Fields {
+			fields[j].Set(i, f.At(r.idx))
+		}
+	}
+
+	frame := data.NewFrame(first.Name, fields...)
+	frame.Meta = first.Meta
+	return frame, nil
+}
+
+// logsTimeFieldIdx returns the index of the time field in the log frame
+func logsTimeFieldIdx(frame *data.Frame) int {
+	for i, f := range frame.Fields {
+		if f.Name == gTimeField && f.Type() == data.FieldTypeTime {
+			return i
+		}
+	}
+	return -1
+}
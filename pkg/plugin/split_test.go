@@ -0,0 +1,212 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func Test_splitTimeRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	f := func(tr backend.TimeRange, interval time.Duration, want []backend.TimeRange) {
+		t.Helper()
+		got := splitTimeRange(tr, interval)
+		if len(got) != len(want) {
+			t.Fatalf("expected %d ranges; got %d: %v", len(want), len(got), got)
+		}
+		for i := range got {
+			if !got[i].From.Equal(want[i].From) || !got[i].To.Equal(want[i].To) {
+				t.Fatalf("range #%d: expected %v; got %v", i, want[i], got[i])
+			}
+		}
+	}
+
+	// disabled splitting
+	tr := backend.TimeRange{From: from, To: from.Add(time.Hour)}
+	f(tr, 0, []backend.TimeRange{tr})
+
+	// interval is bigger than time range
+	f(tr, 2*time.Hour, []backend.TimeRange{tr})
+
+	// time range is split from the newest to the oldest sub range
+	f(backend.TimeRange{From: from, To: from.Add(150 * time.Minute)}, time.Hour, []backend.TimeRange{
+		{From: from.Add(90 * time.Minute), To: from.Add(150 * time.Minute)},
+		{From: from.Add(30*time.Minute - time.Nanosecond), To: from.Add(90*time.Minute - time.Nanosecond)},
+		{From: from, To: from.Add(30*time.Minute - 2*time.Nanosecond)},
+	})
+}
+
+func Test_mergeLogFrames(t *testing.T) {
+	newFrame := func(lines ...int) *data.Frame {
+		timeFd := data.NewFieldFromFieldType(data.FieldTypeTime, 0)
+		timeFd.Name = gTimeField
+		lineField := data.NewFieldFromFieldType(data.FieldTypeString, 0)
+		lineField.Name = gLineField
+		labelsField := data.NewFieldFromFieldType(data.FieldTypeJSON, 0)
+		labelsField.Name = gLabelsField
+		for _, l := range lines {
+			timeFd.Append(time.Unix(int64(l), 0))
+			lineField.Append(fmt.Sprintf("line %d", l))
+			labelsField.Append(json.RawMessage(`{}`))
+		}
+		return data.NewFrame("", timeFd, lineField, labelsField)
+	}
+
+	f := func(frames []*data.Frame, limit int, want []string) {
+		t.Helper()
+		got, err := mergeLogFrames(frames, limit, QueryDirectionBackward)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got.Rows() != len(want) {
+			t.Fatalf("expected %d rows; got %d", len(want), got.Rows())
+		}
+		for i, w := range want {
+			if got.Fields[1].At(i) != w {
+				t.Fatalf("row #%d: expected %q; got %q", i, w, got.Fields[1].At(i))
+			}
+		}
+	}
+
+	f([]*data.Frame{newFrame()}, 10, nil)
+	f([]*data.Frame{newFrame(3, 5, 1), newFrame(4, 2)}, 10, []string{"line 5", "line 4", "line 3", "line 2", "line 1"})
+	f([]*data.Frame{newFrame(3, 5, 1), newFrame(4, 2)}, 2, []string{"line 5", "line 4"})
+
+	got, err := mergeLogFrames([]*data.Frame{newFrame(3, 5, 1), newFrame(4, 2)}, 2, QueryDirectionForward)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got.Rows() != 2 || got.Fields[1].At(0) != "line 1" || got.Fields[1].At(1) != "line 2" {
+		t.Fatalf("expected the oldest lines for forward direction; got %v, %v", got.Fields[1].At(0), got.Fields[1].At(1))
+	}
+
+	if _, err := mergeLogFrames(nil, 10, QueryDirectionBackward); err == nil {
+		t.Fatalf("expected error for empty frames")
+	}
+}
+
+func TestDatasource_splitQuery(t *testing.T) {
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		start, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("start"))
+		if err != nil {
+			t.Errorf("unexpected start param: %s", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		end, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("end"))
+		if err != nil {
+			t.Errorf("unexpected end param: %s", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// $__range must be calculated for the whole time range instead of sub ranges
+		if !strings.HasPrefix(r.URL.Query().Get("query"), "error | hits_[1704067200, 1704103200]") {
+			t.Errorf("unexpected query %q", r.URL.Query().Get("query"))
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+			return
+		}
+		// write two lines for every sub range
+		for _, ts := range []time.Time{start, end} {
+			_, _ = fmt.Fprintf(w, `{"_msg":"%s","_time":"%s"}`+"\n", ts.Format(time.RFC3339Nano), ts.Format(time.RFC3339Nano))
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL:      srv.URL,
+		JSONData: []byte(`{"httpMethod":"GET","splitInterval":"1h","splitConcurrency":2}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := func(direction QueryDirection, maxLines int, wantRequests int32, wantLines int) {
+		t.Helper()
+		requests.Store(0)
+		q := &Query{
+			DataQuery: backend.DataQuery{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: from, To: from.Add(10 * time.Hour)},
+			},
+			Expr:      "error | hits_$__range",
+			MaxLines:  maxLines,
+			QueryType: QueryTypeInstant,
+			Direction: direction,
+		}
+		if !ds.shouldSplit(q) {
+			t.Fatalf("expected query to be split")
+		}
+		rsp := ds.query(context.Background(), q)
+		if rsp.Error != nil {
+			t.Fatalf("unexpected error: %s", rsp.Error)
+		}
+		if requests.Load() != wantRequests {
+			t.Fatalf("expected %d requests; got %d", wantRequests, requests.Load())
+		}
+		frame := rsp.Frames[0]
+		if frame.Rows() != wantLines {
+			t.Fatalf("expected %d lines; got %d", wantLines, frame.Rows())
+		}
+		for i := 1; i < frame.Rows(); i++ {
+			prev := frame.Fields[0].At(i - 1).(time.Time)
+			cur := frame.Fields[0].At(i).(time.Time)
+			if direction == QueryDirectionForward && cur.Before(prev) {
+				t.Fatalf("lines must be sorted from the oldest to the newest: %s < %s", cur, prev)
+			}
+			if direction != QueryDirectionForward && cur.After(prev) {
+				t.Fatalf("lines must be sorted from the newest to the oldest: %s > %s", cur, prev)
+			}
+		}
+		// the first line is the oldest or the newest line of the time range
+		first := frame.Fields[0].At(0).(time.Time)
+		if direction == QueryDirectionForward && !first.Equal(from) {
+			t.Fatalf("expected the oldest line first; got %s", first)
+		}
+		if direction != QueryDirectionForward && !first.Equal(from.Add(10*time.Hour)) {
+			t.Fatalf("expected the newest line first; got %s", first)
+		}
+	}
+
+	// the first batch of two sub queries returns enough lines
+	f(QueryDirectionBackward, 3, 2, 3)
+	f(QueryDirectionForward, 3, 2, 3)
+	// all sub queries are executed
+	f(QueryDirectionBackward, 100, 10, 20)
+}
+
+func TestDatasource_shouldSplit(t *testing.T) {
+	ds := &Datasource{grafanaSettings: &GrafanaSettings{splitInterval: time.Hour}}
+	to := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	f := func(queryType QueryType, tr backend.TimeRange, want bool) {
+		t.Helper()
+		q := &Query{DataQuery: backend.DataQuery{TimeRange: tr}, QueryType: queryType}
+		if got := ds.shouldSplit(q); got != want {
+			t.Fatalf("expected shouldSplit=%v for %s query with time range %v; got %v", want, queryType, tr, got)
+		}
+	}
+
+	f(QueryTypeInstant, backend.TimeRange{From: to.Add(-2 * time.Hour), To: to}, true)
+	f("", backend.TimeRange{From: to.Add(-2 * time.Hour), To: to}, true)
+	f(QueryTypeInstant, backend.TimeRange{From: to.Add(-time.Hour), To: to}, false)
+	f(QueryTypeStats, backend.TimeRange{From: to.Add(-2 * time.Hour), To: to}, false)
+	// empty time range must not be split into millions of sub ranges
+	f(QueryTypeInstant, backend.TimeRange{To: to}, false)
+	f(QueryTypeInstant, backend.TimeRange{From: to}, false)
+}
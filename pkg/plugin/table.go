@@ -0,0 +1,195 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// TableOptions defines columns of log lines in table format
+type TableOptions struct {
+	// Columns contains fields of log lines in the order of table columns.
+	// Only these fields are returned if it isn't empty. Otherwise, all fields
+	// of log lines are returned starting from _time and _msg fields.
+	Columns []string `json:"columns"`
+}
+
+// tableFrame converts the log frame into the table frame with a column per field of log lines.
+// The type of every column is inferred from its values. Empty values are returned as nulls,
+// since VictoriaLogs treats empty fields as missing ones.
+func (to TableOptions) tableFrame(frame *data.Frame) (*data.Frame, error) {
+	timeIdx := logsTimeFieldIdx(frame)
+	lineIdx, labelsIdx := -1, -1
+	for i, f := range frame.Fields {
+		switch f.Name {
+		case gLineField:
+			lineIdx = i
+		case gLabelsField:
+			labelsIdx = i
+		}
+	}
+	if timeIdx < 0 || lineIdx < 0 || labelsIdx < 0 {
+		return nil, fmt.Errorf("failed to prepare table: frame doesn't contain log line fields")
+	}
+
+	rows := frame.Rows()
+	times := make([]*time.Time, rows)
+	values := make(map[string][]string)
+	for i := 0; i < rows; i++ {
+		if ts, ok := frame.Fields[timeIdx].At(i).(time.Time); ok {
+			times[i] = &ts
+		}
+		line := logLine{}
+		line.message, _ = frame.Fields[lineIdx].At(i).(string)
+		if raw, ok := frame.Fields[labelsIdx].At(i).(json.RawMessage); ok && len(raw) > 0 {
+			if err := json.Unmarshal(raw, &line.labels); err != nil {
+				return nil, fmt.Errorf("failed to prepare table: cannot parse labels of line #%d: %w", i, err)
+			}
+		}
+		if line.labels == nil {
+			line.labels = make(map[string]string)
+		}
+		line.labels[messageField] = line.message
+		for name, v := range line.labels {
+			column, ok := values[name]
+			if !ok {
+				column = make([]string, rows)
+				values[name] = column
+			}
+			column[i] = v
+		}
+	}
+
+	columns := to.columns(values)
+	fields := make([]*data.Field, 0, len(columns))
+	for _, name := range columns {
+		if name == timeField {
+			fields = append(fields, data.NewField(timeField, nil, times))
+			continue
+		}
+		column, ok := values[name]
+		if !ok {
+			column = make([]string, rows)
+		}
+		fields = append(fields, newTableField(name, column))
+	}
+
+	res := data.NewFrame(frame.Name, fields...)
+	meta := data.FrameMeta{}
+	if frame.Meta != nil {
+		meta = *frame.Meta
+	}
+	meta.PreferredVisualization = data.VisTypeTable
+	res.Meta = &meta
+	return res, nil
+}
+
+// columns returns names of table columns for the given fields of log lines
+func (to TableOptions) columns(values map[string][]string) []string {
+	var columns []string
+	for _, name := range to.Columns {
+		if name = strings.TrimSpace(name); name != "" {
+			columns = append(columns, name)
+		}
+	}
+	if len(columns) > 0 {
+		return columns
+	}
+
+	columns = append(columns, timeField, messageField)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if name != messageField {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append(columns, names...)
+}
+
+// newTableField returns the nullable field of the type inferred from values.
+// The field is a number, bool or time field if all non-empty values have the type.
+// Otherwise, it is a string field.
+func newTableField(name string, values []string) *data.Field {
+	isNumber, isBool, isTime := true, true, true
+	empty := true
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		empty = false
+		if isNumber {
+			_, isNumber = parseTableNumber(v)
+		}
+		if isBool {
+			isBool = v == "true" || v == "false"
+		}
+		if isTime {
+			_, err := time.Parse(time.RFC3339Nano, v)
+			isTime = err == nil
+		}
+	}
+
+	switch {
+	case empty:
+		// the type of missing fields is unknown
+		return data.NewField(name, nil, make([]*string, len(values)))
+	case isNumber:
+		res := make([]*float64, len(values))
+		for i, v := range values {
+			if n, ok := parseTableNumber(v); ok {
+				res[i] = &n
+			}
+		}
+		return data.NewField(name, nil, res)
+	case isBool:
+		res := make([]*bool, len(values))
+		for i, v := range values {
+			if v != "" {
+				b := v == "true"
+				res[i] = &b
+			}
+		}
+		return data.NewField(name, nil, res)
+	case isTime:
+		res := make([]*time.Time, len(values))
+		for i, v := range values {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				res[i] = &t
+			}
+		}
+		return data.NewField(name, nil, res)
+	default:
+		res := make([]*string, len(values))
+		for i, v := range values {
+			if v != "" {
+				s := v
+				res[i] = &s
+			}
+		}
+		return data.NewField(name, nil, res)
+	}
+}
+
+// tableNumberRegexp matches plain decimal literals with optional sign, fraction and exponent
+var tableNumberRegexp = regexp.MustCompile(`^[-+]?(?:[0-9]+(?:\.[0-9]*)?|\.[0-9]+)(?:[eE][-+]?[0-9]+)?$`)
+
+// parseTableNumber parses the plain decimal number. Unlike strconv.ParseFloat, it doesn't accept
+// hex numbers, underscores, NaN and Inf, which are likely strings in logs.
+func parseTableNumber(s string) (float64, bool) {
+	if !tableNumberRegexp.MatchString(s) {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		// the number is out of float64 range
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,171 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestTableOptions_tableFrame(t *testing.T) {
+	type column struct {
+		name   string
+		typ    data.FieldType
+		values []interface{}
+	}
+	f := func(to TableOptions, response string, want []column) {
+		t.Helper()
+		rsp := parseInstantResponse(strings.NewReader(response), newLineCounters("test"), logsParseOptions{})
+		if rsp.Error != nil {
+			t.Fatalf("unexpected error: %s", rsp.Error)
+		}
+		frame, err := to.tableFrame(rsp.Frames[0])
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if frame.Meta.PreferredVisualization != data.VisTypeTable {
+			t.Fatalf("unexpected visualization %q", frame.Meta.PreferredVisualization)
+		}
+		if len(frame.Fields) != len(want) {
+			t.Fatalf("expected %d columns; got %d", len(want), len(frame.Fields))
+		}
+		for i, w := range want {
+			fd := frame.Fields[i]
+			got := column{name: fd.Name, typ: fd.Type()}
+			for j := 0; j < fd.Len(); j++ {
+				v, ok := fd.ConcreteAt(j)
+				if !ok {
+					v = nil
+				}
+				got.values = append(got.values, v)
+			}
+			if !reflect.DeepEqual(got, w) {
+				t.Fatalf("unexpected column #%d\ngot:  %+v\nwant: %+v", i, got, w)
+			}
+		}
+	}
+
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)
+	response := `{"_time":"2024-01-01T00:00:00Z","_msg":"GET /","_stream":"{app=\"api\"}","status":"200","duration":"0.25","cached":"true","started":"2024-01-01T00:00:00Z"}
+{"_time":"2024-01-01T00:01:00Z","_msg":"POST /","_stream":"{app=\"api\"}","status":"500","cached":"false","started":"unknown","user":"bob"}`
+
+	// all fields with inferred types
+	f(TableOptions{}, response, []column{
+		{name: timeField, typ: data.FieldTypeNullableTime, values: []interface{}{t1, t2}},
+		{name: messageField, typ: data.FieldTypeNullableString, values: []interface{}{"GET /", "POST /"}},
+		{name: "app", typ: data.FieldTypeNullableString, values: []interface{}{"api", "api"}},
+		{name: "cached", typ: data.FieldTypeNullableBool, values: []interface{}{true, false}},
+		{name: "duration", typ: data.FieldTypeNullableFloat64, values: []interface{}{0.25, nil}},
+		{name: "started", typ: data.FieldTypeNullableString, values: []interface{}{"2024-01-01T00:00:00Z", "unknown"}},
+		{name: "status", typ: data.FieldTypeNullableFloat64, values: []interface{}{float64(200), float64(500)}},
+		{name: "user", typ: data.FieldTypeNullableString, values: []interface{}{nil, "bob"}},
+	})
+
+	// selected columns in the given order
+	f(TableOptions{Columns: []string{"status", " started ", "", "_time", "missing"}}, response[:strings.IndexByte(response, '\n')], []column{
+		{name: "status", typ: data.FieldTypeNullableFloat64, values: []interface{}{float64(200)}},
+		{name: "started", typ: data.FieldTypeNullableTime, values: []interface{}{t1}},
+		{name: timeField, typ: data.FieldTypeNullableTime, values: []interface{}{t1}},
+		{name: "missing", typ: data.FieldTypeNullableString, values: []interface{}{nil}},
+	})
+
+	// words, hex numbers and numbers with underscores aren't numbers
+	f(TableOptions{Columns: []string{"value"}}, `{"_time":"2024-01-01T00:00:00Z","_msg":"a","value":"1"}
+{"_time":"2024-01-01T00:01:00Z","_msg":"b","value":"Inf"}`, []column{
+		{name: "value", typ: data.FieldTypeNullableString, values: []interface{}{"1", "Inf"}},
+	})
+	f(TableOptions{Columns: []string{"value"}}, `{"_time":"2024-01-01T00:00:00Z","_msg":"a","value":"0x1p-2"}
+{"_time":"2024-01-01T00:01:00Z","_msg":"b","value":"1_000"}
+{"_time":"2024-01-01T00:02:00Z","_msg":"c","value":"NaN"}`, []column{
+		{name: "value", typ: data.FieldTypeNullableString, values: []interface{}{"0x1p-2", "1_000", "NaN"}},
+	})
+
+	// JSON numbers, bools and arrays
+	f(TableOptions{Columns: []string{"status", "ok", "tags"}}, `{"_time":"2024-01-01T00:00:00Z","_msg":"a","status":200,"ok":true,"tags":["x"]}`, []column{
+		{name: "status", typ: data.FieldTypeNullableFloat64, values: []interface{}{float64(200)}},
+		{name: "ok", typ: data.FieldTypeNullableBool, values: []interface{}{true}},
+		{name: "tags", typ: data.FieldTypeNullableString, values: []interface{}{`["x"]`}},
+	})
+}
+
+func TestParseTableNumber(t *testing.T) {
+	f := func(s string, want float64, wantOK bool) {
+		t.Helper()
+		n, ok := parseTableNumber(s)
+		if ok != wantOK || n != want {
+			t.Fatalf("unexpected result for %q; got %v, %v; want %v, %v", s, n, ok, want, wantOK)
+		}
+	}
+
+	f("200", 200, true)
+	f("-1.5", -1.5, true)
+	f("+.5", 0.5, true)
+	f("1.", 1, true)
+	f("1e3", 1000, true)
+	f("2.5E-1", 0.25, true)
+
+	f("", 0, false)
+	f("0x1p-2", 0, false)
+	f("0x10", 0, false)
+	f("1_000", 0, false)
+	f("Inf", 0, false)
+	f("-inf", 0, false)
+	f("Infinity", 0, false)
+	f("NaN", 0, false)
+	f(" 1", 0, false)
+	f("1e", 0, false)
+	f(".", 0, false)
+	f("1e400", 0, false)
+}
+
+func TestTableOptions_tableFrameError(t *testing.T) {
+	frame := data.NewFrame("", data.NewField(gTimeField, nil, []time.Time{}))
+	if _, err := (TableOptions{}).tableFrame(frame); err == nil {
+		t.Fatalf("expected error for the frame without log line fields")
+	}
+}
+
+func TestDatasource_tableQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintln(w, `{"_time":"2024-01-01T00:00:00Z","_msg":"GET /","status":"200"}`)
+		_, _ = fmt.Fprintln(w, `{"_time":"2024-01-01T00:01:00Z","_msg":"POST /","status":"500"}`)
+	}))
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{URL: srv.URL, JSONData: []byte(`{}`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	q := &Query{
+		DataQuery: backend.DataQuery{RefID: "Table", TimeRange: backend.TimeRange{From: time.Unix(0, 0), To: time.Now()}},
+		Expr:      "*",
+		QueryType: QueryTypeInstant,
+		Format:    QueryFormatTable,
+		Table:     TableOptions{Columns: []string{"status", "_msg"}},
+	}
+	if err := q.validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rsp := ds.query(context.Background(), q)
+	if rsp.Error != nil {
+		t.Fatalf("unexpected error: %s", rsp.Error)
+	}
+	frame := rsp.Frames[0]
+	if len(frame.Fields) != 2 || frame.Fields[0].Type() != data.FieldTypeNullableFloat64 || frame.Fields[1].Name != messageField {
+		t.Fatalf("unexpected columns of the table: %v", frame.Fields)
+	}
+	// the newest lines go first by default
+	if v, _ := frame.Fields[0].ConcreteAt(0); v != float64(500) {
+		t.Fatalf("unexpected status of the first row: %v", v)
+	}
+}
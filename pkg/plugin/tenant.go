@@ -0,0 +1,150 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	accountIDHeader = "AccountID"
+	projectIDHeader = "ProjectID"
+)
+
+// tenantHeaders contains headers which define the tenant in VictoriaLogs cluster
+var tenantHeaders = []string{accountIDHeader, projectIDHeader}
+
+// tenantID is the tenant of VictoriaLogs cluster.
+// See https://docs.victoriametrics.com/victorialogs/#multitenancy
+type tenantID struct {
+	accountID uint32
+	projectID uint32
+	// isSet is false if the tenant isn't configured,
+	// so tenant headers aren't sent to the datasource
+	isSet bool
+}
+
+// isTenantHeader returns true if the header defines the tenant
+func isTenantHeader(name string) bool {
+	for _, h := range tenantHeaders {
+		if strings.EqualFold(name, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTenantID parses the tenant in AccountID:ProjectID format.
+// ProjectID can be omitted, then it is set to 0.
+func parseTenantID(s string) (tenantID, error) {
+	s = strings.TrimSpace(s)
+	accountID, projectID, _ := strings.Cut(s, ":")
+	if projectID == "" {
+		projectID = "0"
+	}
+	a, err := strconv.ParseUint(accountID, 10, 32)
+	if err != nil {
+		return tenantID{}, fmt.Errorf("cannot parse AccountID from tenant %q: it must be uint32 value", s)
+	}
+	p, err := strconv.ParseUint(projectID, 10, 32)
+	if err != nil {
+		return tenantID{}, fmt.Errorf("cannot parse ProjectID from tenant %q: it must be uint32 value", s)
+	}
+	return tenantID{accountID: uint32(a), projectID: uint32(p), isSet: true}, nil
+}
+
+// newTenantID returns the tenant from AccountID and ProjectID values.
+// It returns not set tenant if both values are empty.
+func newTenantID(accountID, projectID string) (tenantID, error) {
+	accountID, projectID = strings.TrimSpace(accountID), strings.TrimSpace(projectID)
+	if accountID == "" && projectID == "" {
+		return tenantID{}, nil
+	}
+	if accountID == "" {
+		accountID = "0"
+	}
+	return parseTenantID(accountID + ":" + projectID)
+}
+
+func (t tenantID) String() string {
+	return fmt.Sprintf("%d:%d", t.accountID, t.projectID)
+}
+
+// setHeaders sets the tenant headers of the request to the datasource
+func (t tenantID) setHeaders(h http.Header) {
+	for _, name := range tenantHeaders {
+		h.Del(name)
+	}
+	if !t.isSet {
+		return
+	}
+	h.Set(accountIDHeader, strconv.FormatUint(uint64(t.accountID), 10))
+	h.Set(projectIDHeader, strconv.FormatUint(uint64(t.projectID), 10))
+}
+
+// parseTenantSettings returns the default tenant and the allowed tenants from the datasource settings.
+// AccountID and ProjectID custom headers are used if the values aren't set explicitly,
+// so the datasources configured before keep working.
+func parseTenantSettings(accountID, projectID, allowedTenants string, customHeaders http.Header) (tenantID, map[tenantID]struct{}, error) {
+	if accountID == "" {
+		accountID = customHeaders.Get(accountIDHeader)
+	}
+	if projectID == "" {
+		projectID = customHeaders.Get(projectIDHeader)
+	}
+	defaultTenant, err := newTenantID(accountID, projectID)
+	if err != nil {
+		return tenantID{}, nil, err
+	}
+
+	allowed := make(map[tenantID]struct{})
+	for _, s := range strings.Split(allowedTenants, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		t, err := parseTenantID(s)
+		if err != nil {
+			return tenantID{}, nil, fmt.Errorf("failed to parse allowed tenants: %w", err)
+		}
+		allowed[t] = struct{}{}
+	}
+	return defaultTenant, allowed, nil
+}
+
+// resolveTenant returns the tenant for the query. The tenant can be overridden
+// by the query only with one of the allowed tenants.
+func (gs *GrafanaSettings) resolveTenant(override string) (tenantID, error) {
+	if strings.TrimSpace(override) == "" {
+		return gs.tenant, nil
+	}
+	t, err := parseTenantID(override)
+	if err != nil {
+		return tenantID{}, err
+	}
+	if gs.tenant.isSet && t == gs.tenant {
+		return t, nil
+	}
+	if _, ok := gs.allowedTenants[t]; !ok {
+		return tenantID{}, fmt.Errorf("%w: tenant %q isn't allowed for the datasource", errAccessForbidden, t)
+	}
+	return t, nil
+}
+
+// requestHeaders returns headers of the request to the datasource for the given tenant,
+// the identity of the user and the filtered headers forwarded from the Grafana request
+func (d *Datasource) requestHeaders(t tenantID, id *userIdentity, forwarded http.Header) http.Header {
+	h := d.grafanaSettings.CustomHeaders.Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	t.setHeaders(h)
+	id.setHeader(h)
+	addForwardedHeaders(h, forwarded)
+	return h
+}
+
+// queryHeaders returns headers of the request to the datasource for the query
+func (d *Datasource) queryHeaders(q *Query) http.Header {
+	return d.requestHeaders(q.tenant, q.identity, q.forwardedHeaders)
+}
@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// errAccessForbidden is returned when the Grafana user can't query the datasource,
+// e.g. when the user isn't mapped to any tenant
+var errAccessForbidden = errors.New("access to the datasource is forbidden")
+
+// TenantMappingRule maps Grafana users to the tenant of VictoriaLogs cluster.
+// Empty conditions of the rule match any user.
+type TenantMappingRule struct {
+	// Name is the name of the rule, e.g. the name of the team
+	Name string `json:"name"`
+	// OrgID is the id of Grafana organization
+	OrgID int64 `json:"orgId"`
+	// Role is the role of the user in the organization: Viewer, Editor or Admin
+	Role string `json:"role"`
+	// Users contains logins or emails of the users, e.g. the members of the team.
+	// Grafana doesn't pass teams of the user to the plugin, so teams are defined by their members.
+	Users []string `json:"users"`
+	// Tenant is the tenant in AccountID:ProjectID format
+	Tenant string `json:"tenant"`
+
+	tenant tenantID
+	users  map[string]struct{}
+}
+
+// parseTenantMapping validates the rules of the tenant mapping
+func parseTenantMapping(rules []TenantMappingRule) ([]TenantMappingRule, error) {
+	parsed := make([]TenantMappingRule, 0, len(rules))
+	for i, r := range rules {
+		var err error
+		r.tenant, err = parseTenantID(r.Tenant)
+		if err != nil {
+			return nil, fmt.Errorf("rule #%d %q: %w", i+1, r.Name, err)
+		}
+		if r.OrgID < 0 {
+			return nil, fmt.Errorf("rule #%d %q: orgId can't be negative", i+1, r.Name)
+		}
+		r.users = make(map[string]struct{}, len(r.Users))
+		for _, u := range r.Users {
+			if u = strings.TrimSpace(u); u != "" {
+				r.users[strings.ToLower(u)] = struct{}{}
+			}
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+// matches returns true if the rule matches the user of the given organization
+func (r *TenantMappingRule) matches(orgID int64, user *backend.User) bool {
+	if r.OrgID > 0 && r.OrgID != orgID {
+		return false
+	}
+	if r.Role == "" && len(r.users) == 0 {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+	if r.Role != "" && !strings.EqualFold(r.Role, user.Role) {
+		return false
+	}
+	if len(r.users) > 0 {
+		_, byLogin := r.users[strings.ToLower(user.Login)]
+		_, byEmail := r.users[strings.ToLower(user.Email)]
+		return (byLogin && user.Login != "") || (byEmail && user.Email != "")
+	}
+	return true
+}
+
+// userTenant returns the tenant of the Grafana user from the plugin context.
+// The first matching rule of the tenant mapping defines the tenant.
+// The datasource tenant is returned if the tenant mapping isn't configured.
+func (gs *GrafanaSettings) userTenant(pCtx backend.PluginContext) (tenantID, error) {
+	if len(gs.tenantMapping) == 0 {
+		return gs.tenant, nil
+	}
+	if r := gs.matchTenantRule(pCtx); r != nil {
+		return r.tenant, nil
+	}
+	login := ""
+	if pCtx.User != nil {
+		login = pCtx.User.Login
+	}
+	return tenantID{}, fmt.Errorf("%w: user %q of organization %d isn't mapped to any tenant", errAccessForbidden, login, pCtx.OrgID)
+}
+
+// matchTenantRule returns the first rule of the tenant mapping matching the Grafana user.
+// It returns nil if there is no such rule.
+func (gs *GrafanaSettings) matchTenantRule(pCtx backend.PluginContext) *TenantMappingRule {
+	for i := range gs.tenantMapping {
+		r := &gs.tenantMapping[i]
+		if r.matches(pCtx.OrgID, pCtx.User) {
+			return r
+		}
+	}
+	return nil
+}
+
+// queryTenant returns the tenant for the query of the Grafana user.
+// If the tenant mapping is configured, the query can't override the tenant of the user.
+// Otherwise, the tenant can be overridden with one of the allowed tenants.
+func (gs *GrafanaSettings) queryTenant(pCtx backend.PluginContext, override string) (tenantID, error) {
+	if len(gs.tenantMapping) == 0 {
+		return gs.resolveTenant(override)
+	}
+	t, err := gs.userTenant(pCtx)
+	if err != nil {
+		return tenantID{}, err
+	}
+	if strings.TrimSpace(override) == "" {
+		return t, nil
+	}
+	ot, err := parseTenantID(override)
+	if err != nil {
+		return tenantID{}, err
+	}
+	if ot != t {
+		return tenantID{}, fmt.Errorf("%w: tenant %q isn't mapped to the user", errAccessForbidden, ot)
+	}
+	return t, nil
+}
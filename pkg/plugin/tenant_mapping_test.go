@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestGrafanaSettings_userTenant(t *testing.T) {
+	rules, err := parseTenantMapping([]TenantMappingRule{
+		{Name: "team-a", OrgID: 1, Users: []string{"alice", "bob@example.com"}, Tenant: "10:1"},
+		{Name: "org 1 editors", OrgID: 1, Role: "Editor", Tenant: "10:2"},
+		{Name: "org 2", OrgID: 2, Tenant: "20:0"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	gs := &GrafanaSettings{tenantMapping: rules}
+
+	f := func(orgID int64, user *backend.User, want string) {
+		t.Helper()
+		got, err := gs.userTenant(backend.PluginContext{OrgID: orgID, User: user})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got.String() != want {
+			t.Fatalf("unexpected tenant; got %q; want %q", got, want)
+		}
+	}
+	f(1, &backend.User{Login: "alice", Role: "Viewer"}, "10:1")
+	f(1, &backend.User{Login: "bob", Email: "Bob@example.com", Role: "Viewer"}, "10:1")
+	f(1, &backend.User{Login: "carol", Role: "Editor"}, "10:2")
+	f(2, &backend.User{Login: "alice", Role: "Admin"}, "20:0")
+	// alerting queries have no user, so only rules without user conditions match them
+	f(2, nil, "20:0")
+
+	fErr := func(orgID int64, user *backend.User) {
+		t.Helper()
+		_, err := gs.userTenant(backend.PluginContext{OrgID: orgID, User: user})
+		if !errors.Is(err, errAccessForbidden) {
+			t.Fatalf("expected forbidden error; got %v", err)
+		}
+	}
+	fErr(1, &backend.User{Login: "carol", Role: "Viewer"})
+	fErr(1, nil)
+	fErr(3, &backend.User{Login: "alice", Role: "Admin"})
+
+	// the query can't override the tenant of the user
+	pCtx := backend.PluginContext{OrgID: 2}
+	if got, err := gs.queryTenant(pCtx, "20:0"); err != nil || got.String() != "20:0" {
+		t.Fatalf("unexpected result; got %q, %v", got, err)
+	}
+	if _, err := gs.queryTenant(pCtx, "10:1"); !errors.Is(err, errAccessForbidden) {
+		t.Fatalf("expected forbidden error; got %v", err)
+	}
+
+	// the datasource tenant is used without the mapping
+	gs = &GrafanaSettings{tenant: tenantID{accountID: 5, isSet: true}}
+	if got, err := gs.userTenant(backend.PluginContext{OrgID: 7}); err != nil || got.String() != "5:0" {
+		t.Fatalf("unexpected result; got %q, %v", got, err)
+	}
+}
+
+func TestParseTenantMapping(t *testing.T) {
+	f := func(rule TenantMappingRule) {
+		t.Helper()
+		if _, err := parseTenantMapping([]TenantMappingRule{rule}); err == nil {
+			t.Fatalf("expected error for rule %#v", rule)
+		}
+	}
+	f(TenantMappingRule{OrgID: 1})
+	f(TenantMappingRule{OrgID: 1, Tenant: "foo"})
+	f(TenantMappingRule{OrgID: -1, Tenant: "1:0"})
+}
+
+func TestDatasource_tenantMapping(t *testing.T) {
+	var mu sync.Mutex
+	var gotTenant string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotTenant = r.Header.Get("AccountID") + ":" + r.Header.Get("ProjectID")
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"_msg":"foo","_time":"2024-02-20T14:04:27Z"}`))
+	})
+	mux.HandleFunc("/select/logsql/field_names", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"values":[]}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL:      srv.URL,
+		JSONData: []byte(`{"accountID":"1","tenantMapping":[{"orgId":2,"tenant":"20:3"}]}`),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	now := time.Now()
+	query := func(orgID int64) backend.DataResponse {
+		t.Helper()
+		rsp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+			PluginContext: backend.PluginContext{OrgID: orgID, User: &backend.User{Login: "alice", Role: "Viewer"}},
+			Queries: []backend.DataQuery{
+				{RefID: "A", TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now}, JSON: []byte(`{"expr":"*","queryType":"instant"}`)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return rsp.Responses["A"]
+	}
+
+	if r := query(2); r.Error != nil {
+		t.Fatalf("unexpected error: %s", r.Error)
+	}
+	mu.Lock()
+	if gotTenant != "20:3" {
+		t.Fatalf("unexpected tenant; got %q; want %q", gotTenant, "20:3")
+	}
+	mu.Unlock()
+
+	r := query(1)
+	if !errors.Is(r.Error, errAccessForbidden) {
+		t.Fatalf("expected forbidden error for unmapped user; got %v", r.Error)
+	}
+	if r.Status != backend.StatusForbidden {
+		t.Fatalf("unexpected status %d; want %d", r.Status, backend.StatusForbidden)
+	}
+
+	var status int
+	sender := backend.CallResourceResponseSenderFunc(func(resp *backend.CallResourceResponse) error {
+		status = resp.Status
+		return nil
+	})
+	err = ds.CallResource(context.Background(), &backend.CallResourceRequest{
+		PluginContext: backend.PluginContext{OrgID: 1},
+		Path:          "select/logsql/field_names",
+		URL:           "select/logsql/field_names?query=*",
+	}, sender)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status != http.StatusForbidden {
+		t.Fatalf("unexpected status of resource response %d; want %d", status, http.StatusForbidden)
+	}
+
+	sr, err := ds.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{
+		PluginContext: backend.PluginContext{OrgID: 1},
+		Path:          "req/A",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sr.Status != backend.SubscribeStreamStatusPermissionDenied {
+		t.Fatalf("expected live tailing to be denied for unmapped user")
+	}
+}
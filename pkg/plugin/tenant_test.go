@@ -0,0 +1,183 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestParseTenantID(t *testing.T) {
+	f := func(s, want string) {
+		t.Helper()
+		got, err := parseTenantID(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got.String() != want {
+			t.Fatalf("unexpected tenant for %q; got %q; want %q", s, got, want)
+		}
+	}
+	f("0:0", "0:0")
+	f("12:34", "12:34")
+	f(" 12 ", "12:0")
+	f("12:", "12:0")
+
+	fErr := func(s string) {
+		t.Helper()
+		if _, err := parseTenantID(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+	fErr("")
+	fErr("foo")
+	fErr("1:bar")
+	fErr("-1:0")
+	fErr("4294967296:0")
+}
+
+func TestParseTenantSettings(t *testing.T) {
+	// the tenant is taken from custom headers if it isn't set explicitly
+	tenant, _, err := parseTenantSettings("", "", "", http.Header{"Accountid": {"5"}, "Projectid": {"6"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !tenant.isSet || tenant.String() != "5:6" {
+		t.Fatalf("unexpected tenant %q", tenant)
+	}
+
+	tenant, allowed, err := parseTenantSettings("1", "", "2:0, 3:1", http.Header{"Accountid": {"5"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if tenant.String() != "1:0" {
+		t.Fatalf("unexpected tenant %q", tenant)
+	}
+	if len(allowed) != 2 {
+		t.Fatalf("expected 2 allowed tenants; got %d", len(allowed))
+	}
+
+	tenant, _, err = parseTenantSettings("", "", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if tenant.isSet {
+		t.Fatalf("expected tenant to be not set")
+	}
+
+	if _, _, err := parseTenantSettings("foo", "", "", nil); err == nil {
+		t.Fatalf("expected error for invalid AccountID")
+	}
+	if _, _, err := parseTenantSettings("", "", "1:0,bar", nil); err == nil {
+		t.Fatalf("expected error for invalid allowed tenant")
+	}
+}
+
+func TestGrafanaSettings_resolveTenant(t *testing.T) {
+	gs := &GrafanaSettings{}
+	var err error
+	gs.tenant, gs.allowedTenants, err = parseTenantSettings("1", "0", "2:0,3:1", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f := func(override, want string) {
+		t.Helper()
+		got, err := gs.resolveTenant(override)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got.String() != want {
+			t.Fatalf("unexpected tenant for %q; got %q; want %q", override, got, want)
+		}
+	}
+	f("", "1:0")
+	f("1:0", "1:0")
+	f("2", "2:0")
+	f("3:1", "3:1")
+
+	if _, err := gs.resolveTenant("4:0"); err == nil || !strings.Contains(err.Error(), "isn't allowed") {
+		t.Fatalf("expected not allowed tenant error; got %v", err)
+	}
+	if _, err := gs.resolveTenant("foo"); err == nil {
+		t.Fatalf("expected error for invalid tenant")
+	}
+}
+
+func TestDatasource_tenant(t *testing.T) {
+	var mu sync.Mutex
+	tenants := make(map[string]string)
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		tenants[r.URL.Path] = r.Header.Get("AccountID") + ":" + r.Header.Get("ProjectID")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		_, _ = w.Write([]byte(`{"_msg":"foo","_time":"2024-02-20T14:04:27Z"}`))
+	})
+	mux.HandleFunc("/select/logsql/hits", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		_, _ = w.Write([]byte(`{"hits":[]}`))
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// AccountID custom header must not override the tenant of the query
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL:                     srv.URL,
+		JSONData:                []byte(`{"httpHeaderName1":"AccountID","projectID":"3","allowedTenants":"7:8"}`),
+		DecryptedSecureJSONData: map[string]string{"httpHeaderValue1": "2"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	now := time.Now()
+	tr := backend.TimeRange{From: now.Add(-time.Hour), To: now}
+	rsp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			{RefID: "A", TimeRange: tr, JSON: []byte(`{"expr":"*","queryType":"instant"}`)},
+			{RefID: "B", TimeRange: tr, JSON: []byte(`{"expr":"*","queryType":"hits","field":"level","step":"1m","tenant":"7:8"}`)},
+			{RefID: "C", TimeRange: tr, JSON: []byte(`{"expr":"*","queryType":"instant","tenant":"9:0"}`)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, refID := range []string{"A", "B"} {
+		if r := rsp.Responses[refID]; r.Error != nil {
+			t.Fatalf("unexpected error for query %s: %s", refID, r.Error)
+		}
+	}
+	if r := rsp.Responses["C"]; r.Error == nil || !strings.Contains(r.Error.Error(), `tenant "9:0" isn't allowed`) {
+		t.Fatalf("expected not allowed tenant error for query C; got %v", r.Error)
+	}
+
+	if _, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	f := func(path, want string) {
+		t.Helper()
+		if got := tenants[path]; got != want {
+			t.Fatalf("unexpected tenant of %s request; got %q; want %q", path, got, want)
+		}
+	}
+	f("/select/logsql/query", "2:3")
+	f("/select/logsql/hits", "7:8")
+	f("/health", "2:3")
+}
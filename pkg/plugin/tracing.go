@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// span attributes of the query pipeline
+const (
+	attrQueryType     = attribute.Key("victorialogs.query_type")
+	attrRefID         = attribute.Key("victorialogs.ref_id")
+	attrTenant        = attribute.Key("victorialogs.tenant")
+	attrResponseBytes = attribute.Key("victorialogs.response_bytes")
+	attrLines         = attribute.Key("victorialogs.lines")
+	attrRetries       = attribute.Key("victorialogs.retries")
+	attrStatusCode    = attribute.Key("http.status_code")
+)
+
+// startSpan starts a new span of the query pipeline. The trace context
+// of the span is propagated to VictoriaLogs by the tracing middleware
+// of the http client, so requests can be traced end to end.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.DefaultTracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records the error of the response if any and ends the span
+func endSpan(span trace.Span, rsp backend.DataResponse) {
+	if rsp.Error != nil {
+		_ = tracing.Error(span, rsp.Error)
+	}
+	span.End()
+}
+
+// queryAttributes returns span attributes which identify the query
+func queryAttributes(q *Query) []attribute.KeyValue {
+	queryType := q.QueryType
+	if queryType == "" {
+		queryType = QueryTypeInstant
+	}
+	return []attribute.KeyValue{
+		attrQueryType.String(string(queryType)),
+		attrRefID.String(q.RefID),
+		attrTenant.String(q.tenant.String()),
+	}
+}
+
+// tenantFromHeaders returns the tenant of VictoriaLogs cluster in AccountID:ProjectID format
+func tenantFromHeaders(headers http.Header) string {
+	accountID, projectID := headers.Get(accountIDHeader), headers.Get(projectIDHeader)
+	if accountID == "" {
+		accountID = "0"
+	}
+	if projectID == "" {
+		projectID = "0"
+	}
+	return accountID + ":" + projectID
+}
+
+// countingReader counts the number of bytes read from the reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
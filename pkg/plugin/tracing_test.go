@@ -0,0 +1,190 @@
+package plugin
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// spanRecorder is a tracer which records the started spans
+type spanRecorder struct {
+	embedded.Tracer
+
+	mu     sync.Mutex
+	spans  []*recordedSpan
+	nextID uint64
+}
+
+type recordedSpan struct {
+	trace.Span
+
+	name  string
+	sc    trace.SpanContext
+	mu    sync.Mutex
+	attrs map[attribute.Key]attribute.Value
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	r.mu.Lock()
+	r.nextID++
+	var spanID trace.SpanID
+	binary.BigEndian.PutUint64(spanID[:], r.nextID)
+	traceID := trace.SpanContextFromContext(ctx).TraceID()
+	if !traceID.IsValid() {
+		binary.BigEndian.PutUint64(traceID[:], r.nextID)
+	}
+	s := &recordedSpan{
+		// the noop span from the empty context implements the rest of the interface
+		Span:  trace.SpanFromContext(context.Background()),
+		name:  name,
+		sc:    trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled}),
+		attrs: make(map[attribute.Key]attribute.Value),
+	}
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+
+	cfg := trace.NewSpanStartConfig(opts...)
+	s.SetAttributes(cfg.Attributes()...)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func (r *spanRecorder) span(name string) *recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (s *recordedSpan) SpanContext() trace.SpanContext { return s.sc }
+
+func (s *recordedSpan) IsRecording() bool { return true }
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) attr(key attribute.Key) attribute.Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attrs[key]
+}
+
+func TestDatasource_queryTracing(t *testing.T) {
+	recorder := &spanRecorder{}
+	tracing.InitDefaultTracer(recorder)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		tracing.InitDefaultTracer(otel.Tracer("github.com/grafana/grafana-plugin-sdk-go"))
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	var mu sync.Mutex
+	var traceparent string
+	var calls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/select/logsql/query", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		traceparent = r.Header.Get("traceparent")
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"_msg":"foo","_time":"2024-02-20T14:04:27Z"}` + "\n" + `{"_msg":"bar","_time":"2024-02-20T14:04:28Z"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	instance, err := NewDatasource(context.Background(), backend.DataSourceInstanceSettings{
+		URL:                     srv.URL,
+		JSONData:                []byte(`{"httpHeaderName1":"AccountID","retryPolicy":{"initialBackoff":"1ms"}}`),
+		DecryptedSecureJSONData: map[string]string{"httpHeaderValue1": "12"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ds := instance.(*Datasource)
+
+	now := time.Now()
+	rsp, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+		Queries: []backend.DataQuery{
+			{
+				RefID:     "A",
+				TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+				JSON:      []byte(`{"expr":"*","queryType":"instant"}`),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if r := rsp.Responses["A"]; r.Error != nil {
+		t.Fatalf("unexpected response error: %s", r.Error)
+	}
+
+	for _, name := range []string{"victorialogs.query", "victorialogs.build_url", "victorialogs.request", "victorialogs.parse_response"} {
+		if recorder.span(name) == nil {
+			t.Fatalf("expected span %q to be recorded", name)
+		}
+	}
+
+	querySpan := recorder.span("victorialogs.query")
+	if got := querySpan.attr(attrQueryType).AsString(); got != string(QueryTypeInstant) {
+		t.Fatalf("unexpected query type attribute %q", got)
+	}
+	if got := querySpan.attr(attrRefID).AsString(); got != "A" {
+		t.Fatalf("unexpected refId attribute %q", got)
+	}
+	if got := querySpan.attr(attrTenant).AsString(); got != "12:0" {
+		t.Fatalf("unexpected tenant attribute %q", got)
+	}
+
+	requestSpan := recorder.span("victorialogs.request")
+	if got := requestSpan.attr(attrRetries).AsInt64(); got != 1 {
+		t.Fatalf("expected 1 retry; got %d", got)
+	}
+	if got := requestSpan.attr(attrStatusCode).AsInt64(); got != http.StatusOK {
+		t.Fatalf("unexpected status code attribute %d", got)
+	}
+
+	parseSpan := recorder.span("victorialogs.parse_response")
+	if got := parseSpan.attr(attrLines).AsInt64(); got != 2 {
+		t.Fatalf("expected 2 lines; got %d", got)
+	}
+	if got := parseSpan.attr(attrResponseBytes).AsInt64(); got == 0 {
+		t.Fatalf("expected response bytes to be recorded")
+	}
+
+	// the trace context must be propagated to the datasource
+	traceID := querySpan.SpanContext().TraceID().String()
+	mu.Lock()
+	defer mu.Unlock()
+	if traceparent == "" {
+		t.Fatalf("expected traceparent header to be sent")
+	}
+	if want := "00-" + traceID + "-"; len(traceparent) < len(want) || traceparent[:len(want)] != want {
+		t.Fatalf("expected traceparent of trace %s; got %q", traceID, traceparent)
+	}
+}
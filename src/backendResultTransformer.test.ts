@@ -0,0 +1,72 @@
+import { createDataFrame, DataQueryResponse, FieldType } from '@grafana/data';
+
+import { transformBackendResult } from './backendResultTransformer';
+import { DerivedFieldConfig, Query, QueryFormat, QueryType } from './types';
+
+const derivedFields: DerivedFieldConfig[] = [{ matcherRegex: 'trace_id=(\\w+)', name: 'traceID', url: 'http://tracing/${__value.raw}' }];
+
+const logsFrame = (refId: string) => createDataFrame({
+  refId,
+  fields: [
+    { name: 'Time', type: FieldType.time, values: [1704067200000] },
+    { name: 'Line', type: FieldType.string, values: ['deploy started trace_id=abc'] },
+    { name: 'labels', type: FieldType.other, values: [{ app: 'api' }] },
+  ],
+});
+
+const annotationsFrame = (refId: string) => createDataFrame({
+  refId,
+  fields: [
+    { name: 'time', type: FieldType.time, values: [1704067200000] },
+    { name: 'timeEnd', type: FieldType.time, values: [1704067260000] },
+    { name: 'title', type: FieldType.string, values: ['deploy started'] },
+    { name: 'text', type: FieldType.string, values: ['deploy started trace_id=abc'] },
+    { name: 'tags', type: FieldType.other, values: [['api']] },
+  ],
+});
+
+describe('transformBackendResult', () => {
+  it('should return annotation frames unchanged', () => {
+    const frame = annotationsFrame('Anno');
+    const queries: Query[] = [{ refId: 'Anno', expr: 'deploy', queryType: QueryType.Instant, format: QueryFormat.Annotations }];
+    const response: DataQueryResponse = { data: [frame] };
+
+    const result = transformBackendResult(response, queries, derivedFields);
+
+    expect(result.data).toHaveLength(1);
+    expect(result.data[0]).toBe(frame);
+    expect(result.data[0].meta?.preferredVisualisationType).toBeUndefined();
+    expect(result.data[0].fields.map((f: { name: string }) => f.name)).toEqual(['time', 'timeEnd', 'title', 'text', 'tags']);
+  });
+
+  it('should process log frames of other queries as streams', () => {
+    const queries: Query[] = [
+      { refId: 'A', expr: 'deploy', queryType: QueryType.Instant },
+      { refId: 'Anno', expr: 'deploy', queryType: QueryType.Instant, format: QueryFormat.Annotations },
+    ];
+    const response: DataQueryResponse = { data: [logsFrame('A'), annotationsFrame('Anno')] };
+
+    const result = transformBackendResult(response, queries, derivedFields);
+
+    expect(result.data).toHaveLength(2);
+    const [logs, annotations] = result.data;
+    expect(logs.refId).toBe('A');
+    expect(logs.meta?.preferredVisualisationType).toBe('logs');
+    expect(logs.fields.map((f: { name: string }) => f.name)).toEqual(['Time', 'Line', 'labels', 'traceID']);
+    expect(annotations.refId).toBe('Anno');
+    expect(annotations.meta?.preferredVisualisationType).toBeUndefined();
+  });
+
+  it('should return table frames unchanged', () => {
+    const frame = createDataFrame({
+      refId: 'T',
+      meta: { preferredVisualisationType: 'table' },
+      fields: [{ name: 'value', type: FieldType.string, values: ['api'] }, { name: 'hits', type: FieldType.number, values: [1] }],
+    });
+    const queries: Query[] = [{ refId: 'T', expr: '*', queryType: QueryType.FieldValues, field: 'app' }];
+
+    const result = transformBackendResult({ data: [frame] }, queries, derivedFields);
+
+    expect(result.data).toEqual([frame]);
+  });
+});
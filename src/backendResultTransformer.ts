@@ -4,12 +4,17 @@ import { getDerivedFields } from './getDerivedFields';
 import { makeTableFrames } from './makeTableFrames';
 import { getHighlighterExpressionsFromQuery } from './queryUtils';
 import { dataFrameHasError } from './responseUtils';
-import { DerivedFieldConfig, Query, QueryType } from './types';
+import { DerivedFieldConfig, Query, QueryFormat, QueryType } from './types';
 
 function isMetricFrame(frame: DataFrame): boolean {
   return frame.fields.every((field) => field.type === FieldType.time || field.type === FieldType.number);
 }
 
+// table frames are prepared by the backend, e.g. for streams and field values queries
+function isTableFrame(frame: DataFrame): boolean {
+  return frame.meta?.preferredVisualisationType === 'table';
+}
+
 // returns a new frame, with meta shallow merged with its original meta
 function setFrameMeta(frame: DataFrame, meta: QueryResultMeta): DataFrame {
   const { meta: oldMeta, ...rest } = frame;
@@ -69,7 +74,12 @@ function processMetricRangeFrames(frames: DataFrame[]): DataFrame[] {
   return frames.map((frame) => setFrameMeta(frame, meta));
 }
 
-// we split the frames into 3 groups, because we will handle
+// annotation frames are prepared by the backend from log lines of annotation queries
+function isAnnotationFrame(frame: DataFrame, queryMap: Map<string, Query>): boolean {
+  return frame.refId != null && queryMap.get(frame.refId)?.format === QueryFormat.Annotations;
+}
+
+// we split the frames into groups, because we will handle
 // each group slightly differently
 function groupFrames(
   frames: DataFrame[],
@@ -78,13 +88,21 @@ function groupFrames(
   streamsFrames: DataFrame[];
   metricInstantFrames: DataFrame[];
   metricRangeFrames: DataFrame[];
+  tableFrames: DataFrame[];
+  annotationFrames: DataFrame[];
 } {
   const streamsFrames: DataFrame[] = [];
   const metricInstantFrames: DataFrame[] = [];
   const metricRangeFrames: DataFrame[] = [];
+  const tableFrames: DataFrame[] = [];
+  const annotationFrames: DataFrame[] = [];
 
   frames.forEach((frame) => {
-    if (!isMetricFrame(frame)) {
+    if (isAnnotationFrame(frame, queryMap)) {
+      annotationFrames.push(frame);
+    } else if (isTableFrame(frame)) {
+      tableFrames.push(frame);
+    } else if (!isMetricFrame(frame)) {
       streamsFrames.push(frame);
     } else {
       const isInstantFrame = frame.refId != null && queryMap.get(frame.refId)?.queryType === QueryType.Instant;
@@ -96,7 +114,7 @@ function groupFrames(
     }
   });
 
-  return { streamsFrames, metricInstantFrames, metricRangeFrames };
+  return { streamsFrames, metricInstantFrames, metricRangeFrames, tableFrames, annotationFrames };
 }
 
 function improveError(error: DataQueryError | undefined, queryMap: Map<string, Query>): DataQueryError | undefined {
@@ -144,7 +162,7 @@ export function transformBackendResult(
 
   const queryMap = new Map(queries.map((query) => [query.refId, query]));
 
-  const { streamsFrames, metricInstantFrames, metricRangeFrames } = groupFrames(dataFrames, queryMap);
+  const { streamsFrames, metricInstantFrames, metricRangeFrames, tableFrames, annotationFrames } = groupFrames(dataFrames, queryMap);
 
   const improvedErrors = errors && errors.map((error) => improveError(error, queryMap)).filter((e) => e !== undefined);
 
@@ -155,6 +173,8 @@ export function transformBackendResult(
       ...processMetricRangeFrames(metricRangeFrames),
       ...processMetricInstantFrames(metricInstantFrames),
       ...processStreamsFrames(streamsFrames, queryMap, derivedFieldConfigs),
+      ...tableFrames,
+      ...annotationFrames,
     ],
   };
 }
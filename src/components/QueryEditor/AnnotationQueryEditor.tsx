@@ -0,0 +1,86 @@
+import React from 'react';
+
+import { AutoSizeInput } from '@grafana/ui';
+
+import { AnnotationOptions, Query, QueryFormat, QueryType, VictoriaLogsQueryEditorProps } from "../../types";
+
+import EditorField from "./EditorField";
+import { EditorRow } from "./EditorRow";
+import QueryEditor from "./QueryEditor";
+import QueryEditorOptionsGroup from "./QueryEditorOptionsGroup";
+
+// AnnotationQueryEditor edits log queries, which log lines are converted into annotations by the backend
+const AnnotationQueryEditor = (props: VictoriaLogsQueryEditorProps) => {
+  const { query, onChange } = props;
+  const annotation = query.annotation ?? {};
+
+  const onQueryChange = (update: Query) => {
+    onChange({ ...update, queryType: QueryType.Instant, format: QueryFormat.Annotations });
+  };
+
+  const onAnnotationChange = (update: AnnotationOptions) => {
+    onQueryChange({ ...query, annotation: { ...annotation, ...update } });
+  };
+
+  const onTextChange = (key: keyof AnnotationOptions) => (e: React.SyntheticEvent<HTMLInputElement>) => {
+    onAnnotationChange({ [key]: e.currentTarget.value.trim() || undefined });
+  };
+
+  const onTagFieldsChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+    const tagFields = e.currentTarget.value.split(',').map(v => v.trim()).filter(Boolean);
+    onAnnotationChange({ tagFields: tagFields.length ? tagFields : undefined });
+  };
+
+  return (
+    <>
+      <QueryEditor {...props} onChange={onQueryChange}/>
+      <EditorRow>
+        <QueryEditorOptionsGroup title="Annotation" collapsedInfo={getCollapsedInfo(annotation)}>
+          <EditorField label="Title field" tooltip="The field of the log line used as the title, e.g. _msg.">
+            <AutoSizeInput
+              minWidth={14}
+              placeholder="none"
+              defaultValue={annotation.titleField ?? ''}
+              onCommitChange={onTextChange('titleField')}
+            />
+          </EditorField>
+          <EditorField label="Text field" tooltip="The field of the log line used as the text. The message of the log line is used by default.">
+            <AutoSizeInput
+              minWidth={14}
+              placeholder="_msg"
+              defaultValue={annotation.textField ?? ''}
+              onCommitChange={onTextChange('textField')}
+            />
+          </EditorField>
+          <EditorField label="Tag fields" tooltip="Comma-separated fields of the log line, e.g. stream labels, which values are used as tags.">
+            <AutoSizeInput
+              minWidth={14}
+              placeholder="app, env"
+              defaultValue={annotation.tagFields?.join(', ') ?? ''}
+              onCommitChange={onTagFieldsChange}
+            />
+          </EditorField>
+          <EditorField label="Region key field" tooltip="Log lines with the same value of the field are shown as a region from the oldest to the newest line.">
+            <AutoSizeInput
+              minWidth={14}
+              placeholder="none"
+              defaultValue={annotation.regionKeyField ?? ''}
+              onCommitChange={onTextChange('regionKeyField')}
+            />
+          </EditorField>
+        </QueryEditorOptionsGroup>
+      </EditorRow>
+    </>
+  );
+};
+
+function getCollapsedInfo(annotation: AnnotationOptions): string[] {
+  const items: string[] = [];
+  annotation.titleField && items.push(`Title: ${annotation.titleField}`);
+  items.push(`Text: ${annotation.textField || '_msg'}`);
+  annotation.tagFields?.length && items.push(`Tags: ${annotation.tagFields.join(', ')}`);
+  annotation.regionKeyField && items.push(`Region key: ${annotation.regionKeyField}`);
+  return items;
+}
+
+export default AnnotationQueryEditor;
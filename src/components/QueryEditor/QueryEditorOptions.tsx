@@ -3,7 +3,7 @@ import React, { useMemo } from 'react';
 import { CoreApp, isValidGrafanaDuration, SelectableValue } from '@grafana/data';
 import { AutoSizeInput, RadioButtonGroup, TextLink } from '@grafana/ui';
 
-import { Query, QueryType } from "../../types";
+import { Query, QueryDirection, QueryFormat, QueryType } from "../../types";
 
 import EditorField from "./EditorField";
 import { EditorRow } from "./EditorRow";
@@ -34,8 +34,50 @@ export const queryTypeOptions: Array<SelectableValue<QueryType>> = [
     label: 'Instant',
     description: "Use `/select/logsql/stats_query` for querying log stats at the given time."
   },
+  {
+    value: QueryType.Streams,
+    label: 'Streams',
+    filter: ({ app }: Props) => app !== CoreApp.UnifiedAlerting && app !== CoreApp.CloudAlerting,
+    description: "Use `/select/logsql/streams` for listing log streams with their labels and hits."
+  },
+  {
+    value: QueryType.StreamIDs,
+    label: 'Stream IDs',
+    filter: ({ app }: Props) => app !== CoreApp.UnifiedAlerting && app !== CoreApp.CloudAlerting,
+    description: "Use `/select/logsql/stream_ids` for listing log stream IDs with their hits."
+  },
+];
+
+const isStreamsQueryType = (queryType?: QueryType) => queryType === QueryType.Streams || queryType === QueryType.StreamIDs;
+
+export const queryDirectionOptions: Array<SelectableValue<QueryDirection>> = [
+  {
+    value: QueryDirection.Backward,
+    label: 'Newest first',
+    description: "Return the newest log lines for the line limit.",
+  },
+  {
+    value: QueryDirection.Forward,
+    label: 'Oldest first',
+    description: "Return the oldest log lines for the line limit.",
+  },
 ];
 
+export const queryFormatOptions: Array<SelectableValue<QueryFormat>> = [
+  {
+    value: QueryFormat.Logs,
+    label: 'Logs',
+    description: "Return log lines for the logs panel.",
+  },
+  {
+    value: QueryFormat.Table,
+    label: 'Table',
+    description: "Return log lines as a table with a column per field.",
+  },
+];
+
+const isTableFormat = (query: Query) => query.queryType === QueryType.Instant && query.format === QueryFormat.Table;
+
 export const QueryEditorOptions = React.memo<Props>(({ app, query, maxLines, onChange, onRunQuery }) => {
     const filteredOptions = queryTypeOptions.filter(option => option.filter?.({ app }) ?? true);
     const queryType = query.queryType;
@@ -71,11 +113,32 @@ export const QueryEditorOptions = React.memo<Props>(({ app, query, maxLines, onC
       }
     }
 
+    const onDirectionChange = (value: QueryDirection) => {
+      onChange({ ...query, direction: value });
+      onRunQuery();
+    }
+
+    const onFormatChange = (value: QueryFormat) => {
+      onChange({ ...query, format: value });
+      onRunQuery();
+    }
+
+    const onColumnsChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+      const columns = e.currentTarget.value.split(',').map(c => c.trim()).filter(Boolean);
+      onChange({ ...query, table: columns.length ? { ...query.table, columns } : undefined });
+      onRunQuery();
+    }
+
     const onStepChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
       onChange({ ...query, step: e.currentTarget.value.trim() });
       onRunQuery();
     }
 
+    const onTenantChange = (e: React.SyntheticEvent<HTMLInputElement>) => {
+      onChange({ ...query, tenant: e.currentTarget.value.trim() || undefined });
+      onRunQuery();
+    }
+
     return (
       <EditorRow>
         <QueryEditorOptionsGroup
@@ -119,6 +182,50 @@ export const QueryEditorOptions = React.memo<Props>(({ app, query, maxLines, onC
               />
             </EditorField>
           )}
+          {isStreamsQueryType(queryType) && (
+            <EditorField label="Limit" tooltip="Upper limit for number of streams returned by query.">
+              <AutoSizeInput
+                className="width-4"
+                placeholder={maxLines.toString()}
+                type="number"
+                min={0}
+                defaultValue={query.maxLines?.toString() ?? ''}
+                onCommitChange={onMaxLinesChange}
+              />
+            </EditorField>
+          )}
+          {queryType === QueryType.Instant && (
+            <EditorField label="Direction" tooltip="The order of log lines sorted by time.">
+              <RadioButtonGroup
+                options={queryDirectionOptions}
+                value={query.direction ?? QueryDirection.Backward}
+                onChange={onDirectionChange}
+              />
+            </EditorField>
+          )}
+          {queryType === QueryType.Instant && (
+            <EditorField label="Format" tooltip="The format of log lines in the response.">
+              <RadioButtonGroup
+                options={queryFormatOptions}
+                value={query.format === QueryFormat.Table ? QueryFormat.Table : QueryFormat.Logs}
+                onChange={onFormatChange}
+              />
+            </EditorField>
+          )}
+          {isTableFormat(query) && (
+            <EditorField
+              label="Columns"
+              tooltip="Comma-separated fields of log lines in the order of table columns. All fields are returned if empty."
+            >
+              <AutoSizeInput
+                minWidth={14}
+                placeholder={'all fields'}
+                type="string"
+                defaultValue={query.table?.columns?.join(', ') ?? ''}
+                onCommitChange={onColumnsChange}
+              />
+            </EditorField>
+          )}
           {queryType === QueryType.StatsRange && (
             <EditorField
               label="Step"
@@ -135,6 +242,18 @@ export const QueryEditorOptions = React.memo<Props>(({ app, query, maxLines, onC
               />
             </EditorField>
           )}
+          <EditorField
+            label="Tenant"
+            tooltip="Overrides the tenant of the datasource in AccountID:ProjectID format. The tenant must be one of the allowed tenants in the datasource settings."
+          >
+            <AutoSizeInput
+              className="width-6"
+              placeholder={'default'}
+              type="string"
+              defaultValue={query.tenant ?? ''}
+              onCommitChange={onTenantChange}
+            />
+          </EditorField>
         </QueryEditorOptionsGroup>
       </EditorRow>
     );
@@ -147,7 +266,7 @@ interface CollapsedInfoProps {
   query: Query;
   maxLines: number,
   isValidStep: boolean,
-  queryType?: string;
+  queryType?: QueryType;
 }
 
 function getCollapsedInfo({ query, queryType, maxLines, isValidStep }: CollapsedInfoProps): string[] {
@@ -166,5 +285,19 @@ function getCollapsedInfo({ query, queryType, maxLines, isValidStep }: Collapsed
     items.push(`Line limit: ${query.maxLines ?? maxLines}`);
   }
 
+  if (isStreamsQueryType(queryType) && maxLines) {
+    items.push(`Limit: ${query.maxLines ?? maxLines}`);
+  }
+
+  if (queryType === QueryType.Instant && query.direction === QueryDirection.Forward) {
+    items.push(`Direction: oldest first`);
+  }
+
+  if (isTableFormat(query)) {
+    items.push(`Format: table`);
+  }
+
+  query.tenant && items.push(`Tenant: ${query.tenant}`);
+
   return items;
 }
@@ -74,16 +74,12 @@ export const VariableQueryEditor = ({ onChange, query, datasource, range }: Prop
     }
 
     const getFiledNames = async () => {
-      const list = await datasource.languageProvider?.getFieldList({
-        type: FilterFieldType.FieldName,
-        timeRange: range,
-        limit,
-      })
-      const result = list ? list.map(({ value, hits }) => ({
+      const list = await datasource.getFieldHits({ refId, type: FilterFieldType.FieldName, limit }, range)
+      const result = list.map(({ value, hits }) => ({
         value,
         label: value || " ",
         description: `hits: ${hits}`,
-      })) : []
+      }))
       setFieldNames(result)
     }
 
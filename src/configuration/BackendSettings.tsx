@@ -0,0 +1,535 @@
+import React, { ReactNode, useState } from 'react';
+
+import { DataSourcePluginOptionsEditorProps } from '@grafana/data';
+import { InlineField, InlineSwitch, Input, SecretInput, TextArea } from '@grafana/ui';
+
+import { Options } from "../types";
+
+type Props = Pick<DataSourcePluginOptionsEditorProps<Options>, 'options' | 'onOptionsChange'>;
+
+export type BackendSettingField = {
+  // path of the setting in jsonData, e.g. ['retryPolicy', 'maxAttempts']
+  path: string[];
+  label: string;
+  tooltip: ReactNode;
+  placeholder?: string;
+  // number settings are stored as numbers, since the backend expects them as numbers.
+  // json settings are edited as text and stored as parsed objects.
+  // secret settings are stored in secureJsonData by the last element of the path
+  type?: 'number' | 'text' | 'switch' | 'json' | 'secret';
+}
+
+export type BackendSettingsSection = {
+  title: string;
+  description?: ReactNode;
+  fields: BackendSettingField[];
+}
+
+const tenantSection: BackendSettingsSection = {
+  title: "Multitenancy",
+  description: <>The tenant of VictoriaLogs cluster, which is used for all requests of the datasource. See <a className="text-link" href="https://docs.victoriametrics.com/victorialogs/#multitenancy" target="_blank" rel="noreferrer">multitenancy</a>.</>,
+  fields: [
+    {
+      path: ['accountID'],
+      label: "AccountID",
+      tooltip: <>The AccountID of the tenant. The value of <code>AccountID</code> custom header is used if empty.</>,
+      placeholder: "0",
+    },
+    {
+      path: ['projectID'],
+      label: "ProjectID",
+      tooltip: <>The ProjectID of the tenant. The value of <code>ProjectID</code> custom header is used if empty.</>,
+      placeholder: "0",
+    },
+    {
+      path: ['allowedTenants'],
+      label: "Allowed tenants",
+      tooltip: <>Comma-separated list of tenants in <code>AccountID:ProjectID</code> format, which can be set in the query options instead of the datasource tenant.</>,
+      placeholder: "e.g. 1:0,2:0",
+    },
+    {
+      path: ['tenantMapping'],
+      label: "Tenant mapping",
+      tooltip: <>JSON list of rules, which map Grafana organizations, roles and users to tenants. The first matching rule defines the tenant of the user, and requests of users without matching rule are rejected. Empty conditions of the rule match any user. Grafana doesn&apos;t pass teams of the user to the plugin, so teams are defined by the list of their members.</>,
+      placeholder: '[{"name": "team-a", "orgId": 1, "role": "Viewer", "users": ["alice", "bob@example.com"], "tenant": "1:0"}]',
+      type: 'json',
+    },
+  ],
+}
+
+const extraFiltersSection: BackendSettingsSection = {
+  title: "Extra filters",
+  description: <>Filters which are applied to all requests of the datasource and can&apos;t be overridden in the query. See <a className="text-link" href="https://docs.victoriametrics.com/victorialogs/querying/#extra-filters" target="_blank" rel="noreferrer">extra filters</a>. Filters can contain variables of the Grafana user: <code>{'${__user.login}'}</code>, <code>{'${__user.email}'}</code>, <code>{'${__user.name}'}</code>, <code>{'${__user.role}'}</code>, <code>{'${__org.id}'}</code> and <code>{'${__team}'}</code> - the name of the matching tenant mapping rule. Requests are rejected if the variable has no value for the user.</>,
+  fields: [
+    {
+      path: ['extraFilters'],
+      label: "Extra filters",
+      tooltip: <>LogsQL filter, which is sent in <code>extra_filters</code> query arg.</>,
+      placeholder: 'e.g. user:="${__user.login}"',
+    },
+    {
+      path: ['extraStreamFilters'],
+      label: "Extra stream filters",
+      tooltip: <>Stream filter, which is sent in <code>extra_stream_filters</code> query arg.</>,
+      placeholder: 'e.g. {namespace="${__team}"}',
+    },
+  ],
+}
+
+const identityTokenSection: BackendSettingsSection = {
+  title: "Signed identity",
+  description: <>Requests to the datasource contain short-lived JWT with the login, email, name, role, organization and team of the Grafana user, so vmauth or a proxy in front of VictoriaLogs can route requests and check access of the user. Headers of the Grafana request are not forwarded in this mode unless the header forwarding mode is set. The team is the name of the matching tenant mapping rule.</>,
+  fields: [
+    {
+      path: ['identityToken', 'enabled'],
+      label: "Enabled",
+      tooltip: <>Enables signed identity tokens.</>,
+      type: 'switch',
+    },
+    {
+      path: ['identityToken', 'algorithm'],
+      label: "Algorithm",
+      tooltip: <>The signing algorithm: <code>HS256</code> with the shared secret or <code>RS256</code> with RSA private key in PEM format.</>,
+      placeholder: "HS256",
+    },
+    {
+      path: ['identityTokenKey'],
+      label: "Signing key",
+      tooltip: <>The shared secret of at least 32 bytes for <code>HS256</code> or RSA private key in PEM format for <code>RS256</code>. The key is stored encrypted.</>,
+      type: 'secret',
+    },
+    {
+      path: ['identityToken', 'issuer'],
+      label: "Issuer",
+      tooltip: <>The value of <code>iss</code> claim.</>,
+      placeholder: "e.g. grafana",
+    },
+    {
+      path: ['identityToken', 'audience'],
+      label: "Audience",
+      tooltip: <>The value of <code>aud</code> claim.</>,
+      placeholder: "e.g. vmauth",
+    },
+    {
+      path: ['identityToken', 'keyId'],
+      label: "Key ID",
+      tooltip: <>The value of <code>kid</code> header of the token, which helps the verifier to pick the key.</>,
+    },
+    {
+      path: ['identityToken', 'ttl'],
+      label: "TTL",
+      tooltip: <>How long the token is valid.</>,
+      placeholder: "5m",
+    },
+    {
+      path: ['identityToken', 'header'],
+      label: "Header",
+      tooltip: <>The header of the request with the token. The token is sent as Bearer token in the <code>Authorization</code> header by default. Another header must be set if basic auth is enabled.</>,
+      placeholder: "Authorization",
+    },
+  ],
+}
+
+const headerForwardingSection: BackendSettingsSection = {
+  title: "Header forwarding",
+  description: <>Headers of the Grafana request forwarded to the datasource. Forwarded headers don&apos;t override custom headers, and tenant headers are never forwarded. Header names in the lists are case-insensitive regular expressions matching the whole name.</>,
+  fields: [
+    {
+      path: ['headerForwarding', 'mode'],
+      label: "Mode",
+      tooltip: <><code>all</code> forwards all headers, <code>allowlist</code> forwards only headers from the allowlist, <code>oauth</code> forwards only OAuth identity tokens in <code>Authorization</code> and <code>X-Id-Token</code> headers and <code>none</code> doesn&apos;t forward headers. The default mode is <code>all</code>, or <code>none</code> if the signed identity is enabled.</>,
+      placeholder: "all",
+    },
+    {
+      path: ['headerForwarding', 'allowlist'],
+      label: "Allowlist",
+      tooltip: <>JSON list of headers forwarded in <code>allowlist</code> mode.</>,
+      placeholder: '["Authorization", "X-Team-.*"]',
+      type: 'json',
+    },
+    {
+      path: ['headerForwarding', 'denylist'],
+      label: "Denylist",
+      tooltip: <>JSON list of headers which are never forwarded.</>,
+      placeholder: '["Cookie"]',
+      type: 'json',
+    },
+  ],
+}
+
+const logLevelsSection: BackendSettingsSection = {
+  title: "Log levels",
+  description: <>Values of level fields, e.g. <code>err</code>, <code>ERROR</code> or <code>warn</code>, are normalized into Grafana log levels.</>,
+  fields: [
+    {
+      path: ['logsVolumeLevelField'],
+      label: "Logs volume level field",
+      tooltip: <>The field which groups hits of the logs volume histogram in Explore by log level.</>,
+      placeholder: "level",
+    },
+    {
+      path: ['detectedLevelFields'],
+      label: "Detected level fields",
+      tooltip: <>JSON list of fields checked in order to detect the level of log lines. The level is searched in the message if no field contains it.</>,
+      placeholder: '["level", "severity", "lvl", "log.level", "priority"]',
+      type: 'json',
+    },
+  ],
+}
+
+const logFieldsSection: BackendSettingsSection = {
+  title: "Log fields",
+  description: <>Numbers, booleans, arrays and objects in fields of log lines are returned as JSON text.</>,
+  fields: [
+    {
+      path: ['flattenNestedFields'],
+      label: "Flatten nested fields",
+      tooltip: <>Flattens nested objects into fields with dotted keys, e.g. <code>{'{"http":{"status":200}}'}</code> into <code>http.status</code> field.</>,
+      type: 'switch',
+    },
+  ],
+}
+
+const splitSection: BackendSettingsSection = {
+  title: "Query splitting",
+  description: <>Long log queries can be split into several sub queries by time range, which are executed concurrently.</>,
+  fields: [
+    {
+      path: ['splitInterval'],
+      label: "Split interval",
+      tooltip: <>The time range of log queries longer than this interval is split into sub queries of this interval. Leave empty to disable splitting.</>,
+      placeholder: "e.g. 1d",
+    },
+    {
+      path: ['splitConcurrency'],
+      label: "Split concurrency",
+      tooltip: <>The max number of concurrently executed sub queries.</>,
+      placeholder: "4",
+      type: 'number',
+    },
+  ],
+}
+
+const resultCacheSection: BackendSettingsSection = {
+  title: "Result cache",
+  description: <>Responses of stats and hits queries can be cached in memory. Alerting queries are never cached.</>,
+  fields: [
+    {
+      path: ['resultCacheSize'],
+      label: "Cache size",
+      tooltip: <>The max number of cached responses. Leave empty or set to <code>0</code> to disable the cache.</>,
+      placeholder: "0",
+      type: 'number',
+    },
+    {
+      path: ['resultCacheTTL'],
+      label: "Cache TTL",
+      tooltip: <>How long the response is kept in the cache. The time range of stats queries is aligned to this value.</>,
+      placeholder: "1m",
+    },
+  ],
+}
+
+const extentCacheSection: BackendSettingsSection = {
+  title: "Extent cache",
+  description: <>Closed buckets of stats range and hits queries can be cached, so only the missing part of the time range is requested on dashboard refresh.</>,
+  fields: [
+    {
+      path: ['extentCacheSize'],
+      label: "Extent cache size",
+      tooltip: <>The max number of cached range queries. Leave empty or set to <code>0</code> to disable the cache.</>,
+      placeholder: "0",
+      type: 'number',
+    },
+    {
+      path: ['extentCacheFreshness'],
+      label: "Extent cache freshness",
+      tooltip: <>Buckets within this window before now are never cached, since they still can be changed by late-arriving logs.</>,
+      placeholder: "10m",
+    },
+  ],
+}
+
+const concurrencySection: BackendSettingsSection = {
+  title: "Concurrency",
+  fields: [
+    {
+      path: ['maxConcurrentRequests'],
+      label: "Max concurrent requests",
+      tooltip: <>The max number of concurrent requests to VictoriaLogs. Live tailing requests are not limited.</>,
+      placeholder: "16",
+      type: 'number',
+    },
+    {
+      path: ['queueTimeout'],
+      label: "Queue timeout",
+      tooltip: <>How long the request waits for a free slot if the max number of concurrent requests is reached.</>,
+      placeholder: "1m",
+    },
+  ],
+}
+
+const retrySection: BackendSettingsSection = {
+  title: "Retries",
+  description: <>Requests are retried on connection errors and on <code>429</code>, <code>502</code>, <code>503</code> and <code>504</code> responses with exponential backoff. Alerting queries use a separate policy.</>,
+  fields: [
+    {
+      path: ['retryPolicy', 'maxAttempts'],
+      label: "Max attempts",
+      tooltip: <>The max number of attempts including the first one.</>,
+      placeholder: "2",
+      type: 'number',
+    },
+    {
+      path: ['retryPolicy', 'initialBackoff'],
+      label: "Initial backoff",
+      tooltip: <>The delay before the first retry. The delay is doubled for every next retry.</>,
+      placeholder: "100ms",
+    },
+    {
+      path: ['retryPolicy', 'maxBackoff'],
+      label: "Max backoff",
+      tooltip: <>The max delay between retries. Requests are not retried if <code>Retry-After</code> header of the response exceeds this value.</>,
+      placeholder: "2s",
+    },
+    {
+      path: ['alertingRetryPolicy', 'maxAttempts'],
+      label: "Alerting: Max attempts",
+      tooltip: <>The max number of attempts including the first one.</>,
+      placeholder: "3",
+      type: 'number',
+    },
+    {
+      path: ['alertingRetryPolicy', 'initialBackoff'],
+      label: "Alerting: Initial backoff",
+      tooltip: <>The delay before the first retry. The delay is doubled for every next retry.</>,
+      placeholder: "500ms",
+    },
+    {
+      path: ['alertingRetryPolicy', 'maxBackoff'],
+      label: "Alerting: Max backoff",
+      tooltip: <>The max delay between retries. Requests are not retried if <code>Retry-After</code> header of the response exceeds this value.</>,
+      placeholder: "10s",
+    },
+  ],
+}
+
+const circuitBreakerSection: BackendSettingsSection = {
+  title: "Circuit breaker",
+  description: <>The circuit breaker rejects requests to the VictoriaLogs endpoint after too many failed requests, so the failing endpoint isn't overloaded.</>,
+  fields: [
+    {
+      path: ['circuitBreaker', 'enabled'],
+      label: "Enabled",
+      tooltip: <>Enables the circuit breaker for every VictoriaLogs endpoint.</>,
+      type: 'switch',
+    },
+    {
+      path: ['circuitBreaker', 'failureThreshold'],
+      label: "Failure threshold",
+      tooltip: <>The number of consecutive failed requests after which the circuit breaker opens.</>,
+      placeholder: "5",
+      type: 'number',
+    },
+    {
+      path: ['circuitBreaker', 'failureRate'],
+      label: "Failure rate",
+      tooltip: <>The ratio of failed requests in the window after which the circuit breaker opens. The value must be in <code>(0, 1]</code> range.</>,
+      placeholder: "0.5",
+      type: 'number',
+    },
+    {
+      path: ['circuitBreaker', 'minRequests'],
+      label: "Min requests",
+      tooltip: <>The min number of requests in the window required to check the failure rate.</>,
+      placeholder: "20",
+      type: 'number',
+    },
+    {
+      path: ['circuitBreaker', 'window'],
+      label: "Window",
+      tooltip: <>The interval during which the failure rate is calculated.</>,
+      placeholder: "1m",
+    },
+    {
+      path: ['circuitBreaker', 'openTimeout'],
+      label: "Open timeout",
+      tooltip: <>How long the circuit breaker stays open before it allows probe requests.</>,
+      placeholder: "30s",
+    },
+    {
+      path: ['circuitBreaker', 'halfOpenRequests'],
+      label: "Half-open requests",
+      tooltip: <>The number of successful probe requests required to close the circuit breaker.</>,
+      placeholder: "1",
+      type: 'number',
+    },
+  ],
+}
+
+export const backendSettingsSections: BackendSettingsSection[] = [
+  tenantSection,
+  extraFiltersSection,
+  identityTokenSection,
+  headerForwardingSection,
+  logLevelsSection,
+  logFieldsSection,
+  splitSection,
+  resultCacheSection,
+  extentCacheSection,
+  concurrencySection,
+  retrySection,
+  circuitBreakerSection,
+]
+
+export const BackendSettings = (props: Props) => {
+  const { options, onOptionsChange } = props;
+
+  const onChange = (field: BackendSettingField) => (event: React.FormEvent<HTMLInputElement>) => {
+    const raw = event.currentTarget.value;
+    const value = field.type === 'number' ? parseNumber(raw) : raw || undefined;
+    onOptionsChange({
+      ...options,
+      jsonData: setIn(options.jsonData, field.path, value),
+    });
+  };
+
+  const onSwitchChange = (field: BackendSettingField) => (event: React.FormEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: setIn(options.jsonData, field.path, event.currentTarget.checked),
+    });
+  };
+
+  const onSecretChange = (field: BackendSettingField) => (event: React.FormEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      secureJsonData: { ...options.secureJsonData, [field.path[field.path.length - 1]]: event.currentTarget.value },
+    });
+  };
+
+  const onSecretReset = (field: BackendSettingField) => () => {
+    const key = field.path[field.path.length - 1];
+    onOptionsChange({
+      ...options,
+      secureJsonFields: { ...options.secureJsonFields, [key]: false },
+      secureJsonData: { ...options.secureJsonData, [key]: '' },
+    });
+  };
+
+  return (
+    <>
+      {backendSettingsSections.map((section) => (
+        <div key={section.title}>
+          <h3 className="page-heading">{section.title}</h3>
+          {section.description && <p className="text-help">{section.description}</p>}
+          <div className="gf-form-group">
+            {section.fields.map((field) => (
+              <div className="gf-form" key={field.path.join('.')}>
+                <InlineField
+                  label={field.label}
+                  labelWidth={28}
+                  tooltip={field.tooltip}
+                  interactive={true}
+                >
+                  {field.type === 'json' ? (
+                    <JSONInput
+                      value={getIn(options.jsonData, field.path)}
+                      placeholder={field.placeholder}
+                      onChange={(value) => onOptionsChange({
+                        ...options,
+                        jsonData: setIn(options.jsonData, field.path, value),
+                      })}
+                    />
+                  ) : field.type === 'secret' ? (
+                    <SecretInput
+                      className="width-24"
+                      isConfigured={!!options.secureJsonFields?.[field.path[field.path.length - 1]]}
+                      value={getIn(options.secureJsonData, field.path.slice(-1)) ?? ''}
+                      onChange={onSecretChange(field)}
+                      onReset={onSecretReset(field)}
+                      placeholder={field.placeholder}
+                    />
+                  ) : field.type === 'switch' ? (
+                    <InlineSwitch
+                      value={!!getIn(options.jsonData, field.path)}
+                      onChange={onSwitchChange(field)}
+                    />
+                  ) : (
+                    <Input
+                      className="width-12"
+                      type={field.type || 'text'}
+                      value={`${getIn(options.jsonData, field.path) ?? ''}`}
+                      onChange={onChange(field)}
+                      spellCheck={false}
+                      placeholder={field.placeholder}
+                    />
+                  )}
+                </InlineField>
+              </div>
+            ))}
+          </div>
+        </div>
+      ))}
+    </>
+  );
+};
+
+type JSONInputProps = {
+  value: unknown;
+  placeholder?: string;
+  onChange: (value: unknown) => void;
+}
+
+// JSONInput keeps the raw text while it is edited and updates the value only if the text is valid JSON
+const JSONInput = ({ value, placeholder, onChange }: JSONInputProps) => {
+  const [text, setText] = useState(value === undefined ? '' : JSON.stringify(value, null, 2));
+  const [invalid, setInvalid] = useState(false);
+
+  const onBlur = () => {
+    if (text.trim() === '') {
+      setInvalid(false);
+      onChange(undefined);
+      return;
+    }
+    try {
+      onChange(JSON.parse(text));
+      setInvalid(false);
+    } catch (e) {
+      setInvalid(true);
+    }
+  };
+
+  return (
+    <TextArea
+      cols={60}
+      rows={6}
+      value={text}
+      invalid={invalid}
+      placeholder={placeholder}
+      onChange={(e) => setText(e.currentTarget.value)}
+      onBlur={onBlur}
+    />
+  );
+};
+
+const parseNumber = (value: string): number | undefined => {
+  if (value === '') {
+    return undefined;
+  }
+  const n = Number(value);
+  return isNaN(n) ? undefined : n;
+};
+
+const getIn = (obj: any, path: string[]): any => {
+  return path.reduce((acc, key) => (acc === undefined || acc === null ? undefined : acc[key]), obj);
+};
+
+const setIn = <T extends Record<string, any>>(obj: T, path: string[], value: any): T => {
+  const [key, ...rest] = path;
+  const current = obj?.[key];
+  return {
+    ...obj,
+    [key]: rest.length ? setIn(current || {}, rest, value) : value,
+  };
+};
@@ -7,6 +7,7 @@ import { DataSourceHttpSettings } from "@grafana/ui";
 import { Options } from '../types';
 
 import { AlertingSettings } from './AlertingSettings';
+import { BackendSettings } from "./BackendSettings";
 import { HelpfulLinks } from "./HelpfulLinks";
 import { LimitsSettings } from "./LimitSettings";
 import { QuerySettings } from './QuerySettings';
@@ -48,6 +49,7 @@ const ConfigEditor = (props: Props) => {
         onChange={(value) => onOptionsChange(setDerivedFields(options, value))}
       />
       <LimitsSettings {...props}/>
+      <BackendSettings {...props}/>
     </>
   );
 };
@@ -4,9 +4,11 @@ import { map } from 'rxjs/operators';
 
 import {
   AdHocVariableFilter,
+  CoreApp,
   DataQueryRequest,
   DataQueryResponse,
   DataSourceInstanceSettings,
+  getDefaultTimeRange,
   LegacyMetricFindQueryOptions,
   LiveChannelScope,
   LoadingState,
@@ -27,28 +29,31 @@ import {
 } from '@grafana/runtime';
 
 import { transformBackendResult } from "./backendResultTransformer";
-import QueryEditor from "./components/QueryEditor/QueryEditor";
+import AnnotationQueryEditor from "./components/QueryEditor/AnnotationQueryEditor";
 import { escapeLabelValueInSelector, isRegexSelector } from "./languageUtils";
 import LogsQlLanguageProvider from "./language_provider";
 import { queryLogsVolume } from "./logsVolumeLegacy";
 import { addLabelToQuery, queryHasFilter, removeLabelFromQuery } from "./modifyQuery";
 import { replaceVariables, returnVariables } from "./parsingUtils";
+import { isValuesQueryType } from "./queryUtils";
 import { regularEscape } from "./regexUtils";
 import {
   DerivedFieldConfig,
+  FieldHits,
   FilterActionType,
   FilterFieldType,
   Options,
   Query,
   QueryBuilderLimits,
   QueryFilterOptions,
+  QueryFormat,
   QueryType,
   RequestArguments,
   SupportingQueryType,
   ToggleFilterAction,
   VariableQuery,
 } from './types';
-import { VariableSupport } from "./variableSupport/VariableSupport";
+import { frameToFieldHits, toBackendQuery, VariableSupport } from "./variableSupport/VariableSupport";
 
 export const REF_ID_STARTER_LOG_VOLUME = 'log-volume-';
 export const REF_ID_STARTER_LOG_SAMPLE = 'log-sample-';
@@ -86,14 +91,20 @@ export class VictoriaLogsDatasource
     this.customQueryParameters = new URLSearchParams(instanceSettings.jsonData.customQueryParameters);
     this.languageProvider = languageProvider ?? new LogsQlLanguageProvider(this);
     this.annotations = {
-      QueryEditor: QueryEditor,
+      QueryEditor: AnnotationQueryEditor,
+      // log lines of annotation queries are converted into annotations by the backend
+      prepareQuery: (anno) => anno.target && {
+        ...anno.target,
+        queryType: QueryType.Instant,
+        format: QueryFormat.Annotations,
+      },
     };
     this.variables = new VariableSupport(this);
     this.queryBuilderLimits = instanceSettings.jsonData.queryBuilderLimits;
   }
 
   query(request: DataQueryRequest<Query>): Observable<DataQueryResponse> {
-    const queries = request.targets.filter(q => q.expr).map((q) => {
+    const queries = request.targets.filter(q => q.expr || isValuesQueryType(q.queryType)).map((q) => {
       return {
         ...q,
         maxLines: q.maxLines ?? this.maxLines,
@@ -169,6 +180,7 @@ export class VictoriaLogsDatasource
       ...target,
       legendFormat: this.templateSrv.replace(target.legendFormat, rest),
       expr: this.interpolateString(exprWithAdHoc, variables),
+      field: target.field && this.templateSrv.replace(target.field, rest),
     };
   }
 
@@ -208,7 +220,7 @@ export class VictoriaLogsDatasource
   async metadataRequest({ url, params, options }: RequestArguments) {
     return await lastValueFrom(
       this._request({
-        url: `/api/datasources/proxy/${this.id}/${url.replace(/^\//, '')}`,
+        url: `/api/datasources/uid/${this.uid}/resources/${url.replace(/^\//, '')}`,
         params,
         options: { method: 'GET', hideFromInspector: true, ...options },
       })
@@ -216,7 +228,7 @@ export class VictoriaLogsDatasource
   }
 
   _request<T = any>({ url, params = {}, options: overrides }: RequestArguments): Observable<FetchResponse<T>> {
-    const queryUrl = url.startsWith(`/api/datasources/proxy/${this.id}`) ? url : `${this.url}/${url}`;
+    const queryUrl = url.startsWith('/api/datasources/') ? url : `${this.url}/${url}`;
 
     const options: BackendSrvRequest = defaults(overrides, {
       url: queryUrl,
@@ -289,14 +301,29 @@ export class VictoriaLogsDatasource
   }
 
   private async processMetricFindQuery(query: VariableQuery, timeRange?: TimeRange): Promise<MetricFindValue[]> {
-    const list = await this.languageProvider?.getFieldList({
-      type: query.type,
-      timeRange,
-      field: query.field,
-      query: query.query,
-      limit: query.limit,
-    });
-    return (list ? list.map(({ value }) => ({ text: value })) : [])
+    const list = await this.getFieldHits(query, timeRange);
+    return list.map(({ value }) => ({ text: value }));
+  }
+
+  // getFieldHits runs fieldNames or fieldValues query of the backend for the variable query
+  async getFieldHits(query: VariableQuery, timeRange?: TimeRange): Promise<FieldHits[]> {
+    if (query.type === FilterFieldType.FieldValue && !query.field) {
+      return [];
+    }
+
+    const request: DataQueryRequest<Query> = {
+      requestId: `${query.refId}-${query.type}`,
+      targets: [toBackendQuery(query)],
+      range: timeRange ?? getDefaultTimeRange(),
+      interval: '',
+      intervalMs: 0,
+      scopedVars: {},
+      timezone: 'browser',
+      app: CoreApp.Unknown,
+      startTime: Date.now(),
+    };
+    const response = await lastValueFrom(super.query(request));
+    return frameToFieldHits(response.data[0]);
   }
 
   getQueryBuilderLimits(key: FilterFieldType): number {
@@ -351,14 +378,13 @@ export class VictoriaLogsDatasource
   getSupplementaryQuery(options: SupplementaryQueryOptions, query: Query, request: DataQueryRequest<Query>): Query | undefined {
     switch (options.type) {
       case SupplementaryQueryType.LogsVolume:
-        const HITS_BY_FIELD = '_stream'
+        // the backend groups hits of the logs volume query by the level field of the datasource settings
         const totalSeconds = request.range.to.diff(request.range.from, "second");
         const step = Math.ceil(totalSeconds / 100) || "";
 
         return {
           ...query,
           step: `${step}s`,
-          field: HITS_BY_FIELD,
           queryType: QueryType.Hits,
           refId: `${REF_ID_STARTER_LOG_VOLUME}${query.refId}`,
           supportingQueryType: SupportingQueryType.LogsVolume,
@@ -7,6 +7,7 @@ import {
   FieldColorModeId,
   FieldConfig,
   FieldType,
+  getLogLevelFromKey,
   LoadingState,
   LogLevel,
   MutableDataFrame,
@@ -31,7 +32,7 @@ export const queryLogsVolume = (datasource: VictoriaLogsDatasource, request: Dat
 
     const subscription = queryObservable.subscribe({
       complete: () => {
-        const aggregatedLogsVolume = aggregateRawLogsVolume(rawLogsVolume, () => LogLevel.unknown);
+        const aggregatedLogsVolume = aggregateRawLogsVolume(rawLogsVolume, extractLevel);
         if (aggregatedLogsVolume[0]) {
           aggregatedLogsVolume[0].meta = {
             custom: {
@@ -75,6 +76,23 @@ export const queryLogsVolume = (datasource: VictoriaLogsDatasource, request: Dat
   });
 }
 
+/**
+ * Returns the level of the logs volume frame, which is normalized by the backend
+ */
+function extractLevel(dataFrame: DataFrame): LogLevel {
+  const level = dataFrame.fields[1]?.labels?.level;
+  return level ? getLogLevelFromKey(level) : LogLevel.unknown;
+}
+
+const logLevelColors: Partial<Record<LogLevel, string>> = {
+  [LogLevel.critical]: '#705da0',
+  [LogLevel.error]: '#e24d42',
+  [LogLevel.warning]: '#eab839',
+  [LogLevel.info]: '#7eb26d',
+  [LogLevel.debug]: '#1f78c1',
+  [LogLevel.trace]: '#6ed0e0',
+};
+
 /**
  * Take multiple data frames, sum up values and group by level.
  * Return a list of data frames, each representing single level.
@@ -141,7 +159,7 @@ function aggregateFields(dataFrames: DataFrame[], config: FieldConfig): DataFram
  */
 function getLogVolumeFieldConfig(level: LogLevel) {
   const name = level;
-  const color = '#8e8e8e'
+  const color = logLevelColors[level] ?? '#8e8e8e'
   return {
     displayNameFromDS: name,
     color: {
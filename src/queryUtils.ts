@@ -3,6 +3,8 @@ import { escapeRegExp } from 'lodash';
 
 import { Filter, FilterOp, LineFilter, OrFilter, parser, PipeExact, PipeMatch, String } from "@grafana/lezer-logql"
 
+import { QueryType } from "./types";
+
 export function getNodesFromQuery(query: string, nodeTypes?: number[]): SyntaxNode[] {
   const nodes: SyntaxNode[] = [];
   const tree = parser.parse(query);
@@ -70,3 +72,17 @@ export function getHighlighterExpressionsFromQuery(input = ''): string[] {
   }
   return results;
 }
+
+// isValuesQueryType returns true for query types returning values with hits,
+// which select all logs of the time range if the expression is empty
+export function isValuesQueryType(queryType?: QueryType): boolean {
+  switch (queryType) {
+    case QueryType.Streams:
+    case QueryType.StreamIDs:
+    case QueryType.FieldNames:
+    case QueryType.FieldValues:
+      return true;
+    default:
+      return false;
+  }
+}
@@ -10,6 +10,28 @@ export interface Options extends DataSourceJsonData {
   customQueryParameters?: string;
   queryBuilderLimits?: QueryBuilderLimits;
   derivedFields?: DerivedFieldConfig[];
+  splitInterval?: string;
+  splitConcurrency?: number;
+  resultCacheSize?: number;
+  resultCacheTTL?: string;
+  extentCacheSize?: number;
+  extentCacheFreshness?: string;
+  maxConcurrentRequests?: number;
+  queueTimeout?: string;
+  retryPolicy?: RetrySettings;
+  alertingRetryPolicy?: RetrySettings;
+  circuitBreaker?: CircuitBreakerSettings;
+  accountID?: string;
+  projectID?: string;
+  allowedTenants?: string;
+  tenantMapping?: TenantMappingRule[];
+  extraFilters?: string;
+  extraStreamFilters?: string;
+  identityToken?: IdentityTokenSettings;
+  headerForwarding?: HeaderForwardingSettings;
+  logsVolumeLevelField?: string;
+  detectedLevelFields?: string[];
+  flattenNestedFields?: boolean;
   // alertmanager?: string;
   // keepCookies?: string[];
   // predefinedOperations?: string;
@@ -20,6 +42,23 @@ export enum QueryDirection {
   Forward = 'forward',
 }
 
+export enum QueryFormat {
+  Logs = 'logs',
+  Annotations = 'annotations',
+  Table = 'table',
+}
+
+export type AnnotationOptions = {
+  titleField?: string;
+  textField?: string; // the message of the log line by default
+  tagFields?: string[];
+  regionKeyField?: string; // pairs start and end events of the region
+};
+
+export type TableOptions = {
+  columns?: string[]; // all fields starting from _time and _msg by default
+};
+
 export enum SupportingQueryType {
   DataSample = 'dataSample',
   LogsSample = 'logsSample',
@@ -31,6 +70,10 @@ export enum QueryType {
   Stats = 'stats', // /select/logsql/stats_query
   StatsRange = 'statsRange', // /select/logsql/stats_query_range
   Hits = 'hits', // /select/logsql/hits
+  Streams = 'streams', // /select/logsql/streams
+  StreamIDs = 'streamIDs', // /select/logsql/stream_ids
+  FieldNames = 'fieldNames', // /select/logsql/field_names
+  FieldValues = 'fieldValues', // /select/logsql/field_values
 }
 
 export enum QueryEditorMode {
@@ -50,7 +93,12 @@ export interface Query extends QueryFromSchema {
   direction?: QueryDirection;
   supportingQueryType?: SupportingQueryType;
   queryType?: QueryType;
-  field?: string; // groups the results by the specified field value for /select/logsql/hits
+  field?: string; // groups the results by the specified field value for /select/logsql/hits, or the field of /select/logsql/field_values
+  tenant?: string; // overrides the datasource tenant in AccountID:ProjectID format
+  cursor?: string; // the cursor of the next page from the metadata of the previous log frame
+  format?: QueryFormat;
+  annotation?: AnnotationOptions; // maps fields of log lines to annotations in annotations format
+  table?: TableOptions; // defines columns of log lines in table format
 }
 
 export type VictoriaLogsQueryEditorProps = QueryEditorProps<VictoriaLogsDatasource, Query, Options>;
@@ -120,3 +168,43 @@ export type QueryBuilderLimits = {
   [FilterFieldType.FieldValue]?: number;
   [FilterFieldType.FieldName]?: number;
 };
+
+export type RetrySettings = {
+  maxAttempts?: number;
+  initialBackoff?: string;
+  maxBackoff?: string;
+};
+
+export type CircuitBreakerSettings = {
+  enabled?: boolean;
+  failureThreshold?: number;
+  failureRate?: number;
+  minRequests?: number;
+  window?: string;
+  openTimeout?: string;
+  halfOpenRequests?: number;
+};
+
+export type IdentityTokenSettings = {
+  enabled?: boolean;
+  algorithm?: 'HS256' | 'RS256';
+  issuer?: string;
+  audience?: string;
+  keyId?: string;
+  ttl?: string;
+  header?: string;
+}
+
+export type HeaderForwardingSettings = {
+  mode?: 'all' | 'allowlist' | 'oauth' | 'none';
+  allowlist?: string[];
+  denylist?: string[];
+}
+
+export type TenantMappingRule = {
+  name?: string;
+  orgId?: number;
+  role?: string;
+  users?: string[];
+  tenant: string;
+};
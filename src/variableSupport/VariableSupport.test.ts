@@ -0,0 +1,108 @@
+import { lastValueFrom, of } from 'rxjs';
+
+import { CoreApp, createDataFrame, DataQueryRequest, FieldType, getDefaultTimeRange } from '@grafana/data';
+
+import { createDatasource } from '../__mocks__/datasource';
+import { FilterFieldType, QueryType, VariableQuery } from '../types';
+
+import { frameToFieldHits, toBackendQuery, toMetricFindFrame, VariableSupport } from './VariableSupport';
+
+// valuesFrame returns the table frame of fieldNames and fieldValues queries of the backend
+const valuesFrame = (values: string[], hits: number[]) => createDataFrame({
+  refId: 'A',
+  meta: { preferredVisualisationType: 'table' },
+  fields: [
+    { name: 'value', type: FieldType.string, values },
+    { name: 'hits', type: FieldType.number, values: hits },
+  ],
+});
+
+const createRequest = (targets: VariableQuery[]): DataQueryRequest<VariableQuery> => ({
+  requestId: 'variable',
+  targets,
+  range: getDefaultTimeRange(),
+  interval: '',
+  intervalMs: 0,
+  scopedVars: {},
+  timezone: 'browser',
+  app: CoreApp.Dashboard,
+  startTime: 0,
+});
+
+describe('VariableSupport', () => {
+  describe('toBackendQuery', () => {
+    it('should convert field name queries', () => {
+      expect(toBackendQuery({ refId: 'A', type: FilterFieldType.FieldName, query: 'error', limit: 10 })).toEqual({
+        refId: 'A',
+        expr: 'error',
+        queryType: QueryType.FieldNames,
+        field: undefined,
+        maxLines: 10,
+      });
+    });
+
+    it('should convert field value queries with empty expression', () => {
+      expect(toBackendQuery({ refId: 'A', type: FilterFieldType.FieldValue, field: 'level' })).toEqual({
+        refId: 'A',
+        expr: '',
+        queryType: QueryType.FieldValues,
+        field: 'level',
+        maxLines: undefined,
+      });
+    });
+  });
+
+  describe('frameToFieldHits', () => {
+    it('should read values and hits of the table frame', () => {
+      expect(frameToFieldHits(valuesFrame(['error', 'info'], [3, 5]))).toEqual([
+        { value: 'error', hits: 3 },
+        { value: 'info', hits: 5 },
+      ]);
+    });
+
+    it('should return no hits without the frame', () => {
+      expect(frameToFieldHits(undefined)).toEqual([]);
+    });
+  });
+
+  describe('toMetricFindFrame', () => {
+    it('should convert values into text and value fields', () => {
+      const frame = toMetricFindFrame(valuesFrame(['error', 'info'], [3, 5]));
+      expect(frame.refId).toBe('A');
+      expect(frame.length).toBe(2);
+      expect(frame.fields.map(f => [f.name, f.type, f.values])).toEqual([
+        ['text', FieldType.string, ['error', 'info']],
+        ['value', FieldType.string, ['error', 'info']],
+      ]);
+    });
+
+    it('should return empty fields for frames without values', () => {
+      const frame = toMetricFindFrame(createDataFrame({ fields: [] }));
+      expect(frame.length).toBe(0);
+      expect(frame.fields.map(f => f.name)).toEqual(['text', 'value']);
+    });
+  });
+
+  describe('query', () => {
+    it('should run backend queries and return variable options', async () => {
+      const ds = createDatasource();
+      const querySpy = jest.spyOn(ds, 'query').mockReturnValue(of({ data: [valuesFrame(['api', 'db'], [1, 2])] }));
+      const variableSupport = new VariableSupport(ds);
+
+      const response = await lastValueFrom(variableSupport.query(createRequest([
+        { refId: 'A', type: FilterFieldType.FieldValue, field: 'app', query: '*' },
+        { refId: 'B', type: FilterFieldType.FieldValue },
+      ])));
+
+      expect(querySpy).toHaveBeenCalledTimes(1);
+      expect(querySpy.mock.calls[0][0].targets).toEqual([
+        { refId: 'A', expr: '*', queryType: QueryType.FieldValues, field: 'app', maxLines: undefined },
+      ]);
+      expect(response.data).toHaveLength(1);
+      expect(response.data[0].fields.map((f: { name: string; values: string[] }) => [f.name, f.values])).toEqual([
+        ['text', ['api', 'db']],
+        ['value', ['api', 'db']],
+      ]);
+    });
+  });
+});
@@ -1,17 +1,20 @@
-import { from, Observable } from 'rxjs';
+import { Observable } from 'rxjs';
 import { map } from 'rxjs/operators';
 
 import {
+  createDataFrame,
   CustomVariableSupport,
+  DataFrame,
   DataQueryRequest,
-  MetricFindValue,
+  DataQueryResponse,
+  FieldType,
   ScopedVars,
   TimeRange
 } from '@grafana/data';
 
 import { VariableQueryEditor } from '../components/VariableQueryEditor/VariableQueryEditor';
 import { VictoriaLogsDatasource } from "../datasource";
-import { VariableQuery } from '../types';
+import { FieldHits, FilterFieldType, Query, QueryType, VariableQuery } from '../types';
 
 export class VariableSupport extends CustomVariableSupport<VictoriaLogsDatasource, VariableQuery> {
   editor = VariableQueryEditor;
@@ -24,9 +27,47 @@ export class VariableSupport extends CustomVariableSupport<VictoriaLogsDatasourc
     return this.datasource.metricFindQuery(query, { scopedVars, range });
   }
 
-  query = (request: DataQueryRequest<VariableQuery>): Observable<{ data: MetricFindValue[] }> => {
-    const result = this.execute(request.targets[0], request.scopedVars, request.range);
-
-    return from(result).pipe(map((data) => ({ data })));
+  // query runs variable queries as fieldNames and fieldValues queries of the backend,
+  // which return tables with values and hits, where values are used as variable options
+  query = (request: DataQueryRequest<VariableQuery>): Observable<DataQueryResponse> => {
+    const backendRequest: DataQueryRequest<Query> = {
+      ...request,
+      // field values can't be requested without the field
+      targets: request.targets.filter(q => q.type !== FilterFieldType.FieldValue || q.field).map(toBackendQuery),
+    };
+    return this.datasource.query(backendRequest).pipe(
+      map((response) => ({ ...response, data: response.data.map(toMetricFindFrame) }))
+    );
   }
 }
+
+// toBackendQuery converts the variable query to the query of the backend
+export function toBackendQuery(query: VariableQuery): Query {
+  return {
+    refId: query.refId,
+    expr: query.query || '',
+    queryType: query.type === FilterFieldType.FieldValue ? QueryType.FieldValues : QueryType.FieldNames,
+    field: query.field,
+    maxLines: query.limit,
+  };
+}
+
+// frameToFieldHits reads values and hits from the table frame of fieldNames and fieldValues queries
+export function frameToFieldHits(frame?: DataFrame): FieldHits[] {
+  const values = frame?.fields.find(f => f.name === 'value')?.values ?? [];
+  const hits = frame?.fields.find(f => f.name === 'hits')?.values ?? [];
+  return values.map((value, i) => ({ value, hits: hits[i] ?? 0 }));
+}
+
+// toMetricFindFrame converts the table frame of the backend into the frame with text and value fields,
+// which Grafana converts into variable options
+export function toMetricFindFrame(frame: DataFrame): DataFrame {
+  const values = frameToFieldHits(frame).map(({ value }) => value);
+  return createDataFrame({
+    refId: frame.refId,
+    fields: [
+      { name: 'text', type: FieldType.string, values },
+      { name: 'value', type: FieldType.string, values },
+    ],
+  });
+}